@@ -1,16 +1,80 @@
 package main
 
 import (
+	"net/http"
+
 	"github.com/danielgtaylor/huma/v2"
 	"mnlr.de/addressserver/routes"
 )
 
 func RegisterApi(api huma.API) {
 
+	// Register GET /info handler for statistics and metadata of the loaded database.
+	huma.Get(api, "/info", routes.Info)
+
 	// Register GET /search handler for fulltext search.
 	huma.Get(api, "/search", routes.FulltextSearch)
 
+	// Register GET /search/structured handler for field based address search.
+	huma.Get(api, "/search/structured", routes.StructuredSearch)
+
+	// Register GET /autocomplete handler for search-as-you-type suggestions.
+	huma.Get(api, "/autocomplete", routes.Autocomplete)
+
+	// Register POST /batch/search handler for geocoding many queries at once.
+	huma.Post(api, "/batch/search", routes.BatchSearch)
+
+	// Register POST /jobs handler for uploading a CSV file to geocode in the background.
+	huma.Post(api, "/jobs", routes.CreateJob, func(o *huma.Operation) {
+		o.DefaultStatus = http.StatusAccepted
+	})
+
+	// Register GET /jobs/{id} handler for the progress of a geocoding job.
+	huma.Get(api, "/jobs/{id}", routes.GetJob)
+
+	// Register GET /jobs/{id}/result handler for downloading the geocoded CSV file.
+	huma.Get(api, "/jobs/{id}/result", routes.DownloadJobResult)
+
+	// Register DELETE /jobs/{id} handler for removing a geocoding job.
+	huma.Delete(api, "/jobs/{id}", routes.DeleteJob)
+
 	// Register GET /reverse handler for reverse geocoding.
 	huma.Get(api, "/reverse", routes.ReverseGeocode)
 
+	// Register POST /batch/reverse handler for reverse geocoding many points at once.
+	huma.Post(api, "/batch/reverse", routes.BatchReverse)
+
+	// Register POST /within handler for the addresses inside a GeoJSON polygon.
+	huma.Post(api, "/within", routes.Within)
+
+	// Register POST /within/count handler for counting the addresses inside a GeoJSON polygon.
+	huma.Post(api, "/within/count", routes.CountWithin)
+
+	// Register GET /bbox handler for the addresses inside a map viewport.
+	huma.Get(api, "/bbox", routes.BBoxAddresses)
+
+	// Register GET /address/{id} handler for address lookups by ID.
+	huma.Get(api, "/address/{id}", routes.GetAddress)
+
+	// Register GET /address/{id}/nearby handler for the neighbours of an address.
+	huma.Get(api, "/address/{id}/nearby", routes.NearbyAddresses)
+
+	// Register GET /cities handler for listing cities.
+	huma.Get(api, "/cities", routes.ListCities)
+
+	// Register GET /cities/{city}/addresses handler for browsing the addresses of a city.
+	huma.Get(api, "/cities/{city}/addresses", routes.ListCityAddresses)
+
+	// Register GET /cities/{city}/streets handler for listing the streets of a city.
+	huma.Get(api, "/cities/{city}/streets", routes.ListCityStreets)
+
+	// Register GET /cities/{city}/streets/{street}/numbers handler for listing the house numbers of a street.
+	huma.Get(api, "/cities/{city}/streets/{street}/numbers", routes.ListStreetNumbers)
+
+	// Register GET /postcodes handler for listing postcodes.
+	huma.Get(api, "/postcodes", routes.ListPostcodes)
+
+	// Register GET /postcodes/{postcode} handler for postcode lookups.
+	huma.Get(api, "/postcodes/{postcode}", routes.GetPostcode)
+
 }
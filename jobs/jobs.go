@@ -0,0 +1,435 @@
+// Package jobs geocodes uploaded CSV files in the background. Every job is
+// kept in its own directory below the jobs directory, holding the uploaded
+// file, the job state as job.json and the enriched file once it is done, so
+// jobs survive a restart of the server. Unfinished jobs are started again
+// from the beginning when the server starts.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"mnlr.de/addressserver/sql"
+)
+
+// State is the processing state of a job
+type State string
+
+const (
+	Queued  State = "queued"
+	Running State = "running"
+	Done    State = "done"
+	Failed  State = "failed"
+)
+
+var (
+	ErrNotFound  = errors.New("job not found")
+	ErrNotDone   = errors.New("job is not done yet")
+	ErrQueueFull = errors.New("too many queued jobs, try again later")
+)
+
+// maxQueued is the number of jobs that may wait for processing
+const maxQueued = 100
+
+// Mapping names the CSV columns holding the address of a row. Either Query,
+// a column with the complete address as free text, or at least one of the
+// structured columns must be set.
+type Mapping struct {
+	Query       string `json:"query,omitempty"`
+	Street      string `json:"street,omitempty"`
+	HouseNumber string `json:"house_number,omitempty"`
+	Postcode    string `json:"postcode,omitempty"`
+	City        string `json:"city,omitempty"`
+}
+
+// Query is the address of a single CSV row, taken from the mapped columns
+type Query struct {
+	Text        string
+	Street      string
+	HouseNumber string
+	Postcode    string
+	City        string
+}
+
+// Result is the geocoding result of a single CSV row. Address is nil if
+// nothing matched.
+type Result struct {
+	Address    *sql.Address
+	Confidence float64 // 0 to 1
+	MatchType  string  // Which parts of the address matched, like in the search results
+}
+
+// Geocoder resolves the address of a single CSV row
+type Geocoder func(q Query) (Result, error)
+
+// Job is the state of a geocoding job as persisted in job.json
+type Job struct {
+	ID            string     `json:"id"`
+	State         State      `json:"state"`
+	Filename      string     `json:"filename,omitempty"`
+	Mapping       Mapping    `json:"mapping"`
+	Delimiter     string     `json:"delimiter"`
+	RowsTotal     int        `json:"rows_total"`
+	RowsProcessed int        `json:"rows_processed"`
+	RowsMatched   int        `json:"rows_matched"`
+	Error         string     `json:"error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
+}
+
+var (
+	dir      string
+	geocode  Geocoder
+	queue    chan string
+	reserved int // Places in the queue held by uploads that are being stored
+	mu       sync.Mutex
+	jobs     = make(map[string]*Job)
+	cancels  = make(map[string]context.CancelFunc) // Cancels the running job
+	initOnce sync.Once
+)
+
+// Init loads the jobs stored in jobsDir, queues the unfinished ones again
+// and starts processing. geocode is called for every row of every job.
+func Init(jobsDir string, geocoder Geocoder) error {
+	var err error
+	initOnce.Do(func() {
+		dir = jobsDir
+		geocode = geocoder
+		queue = make(chan string, maxQueued)
+		err = load()
+		go work()
+	})
+	return err
+}
+
+// load reads the jobs directory and queues the jobs that were not finished
+func load() error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create jobs directory: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read jobs directory: %w", err)
+	}
+
+	var unfinished []*Job
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name(), "job.json"))
+		if err != nil {
+			log.Printf("Warning: skipping job %s: %v", entry.Name(), err)
+			continue
+		}
+		var job Job
+		if err := json.Unmarshal(data, &job); err != nil {
+			log.Printf("Warning: skipping job %s: %v", entry.Name(), err)
+			continue
+		}
+		jobs[job.ID] = &job
+		if job.State == Queued || job.State == Running {
+			unfinished = append(unfinished, &job)
+		}
+	}
+
+	// Restart the interrupted jobs in the order they were created. The running
+	// job and a full queue are more than maxQueued, so the queue grows to hold
+	// them all; new jobs are accepted once fewer than maxQueued are waiting.
+	sort.Slice(unfinished, func(i, j int) bool {
+		return unfinished[i].CreatedAt.Before(unfinished[j].CreatedAt)
+	})
+	if len(unfinished) > maxQueued {
+		queue = make(chan string, len(unfinished))
+	}
+	for _, job := range unfinished {
+		job.State, job.RowsProcessed, job.RowsMatched = Queued, 0, 0
+		if err := save(job); err != nil {
+			return err
+		}
+		queue <- job.ID
+	}
+	if len(unfinished) > 0 {
+		log.Printf("Restarted %d unfinished geocoding jobs.", len(unfinished))
+	}
+	return nil
+}
+
+// Create stores the uploaded CSV file as a new job and queues it. The file
+// must start with a header row containing the mapped columns.
+func Create(r io.Reader, filename string, mapping Mapping, delimiter rune) (*Job, error) {
+	// The place in the queue is reserved first, so a full queue is reported
+	// before the upload is read
+	if err := reserve(); err != nil {
+		return nil, err
+	}
+	job, err := newJob(r, filename, mapping, delimiter)
+
+	mu.Lock()
+	defer mu.Unlock()
+	reserved--
+	if err != nil {
+		return nil, err
+	}
+	jobs[job.ID] = job
+	queue <- job.ID // Doesn't block, the reserved place is free
+	created := *job
+	return &created, nil
+}
+
+// reserve takes a place in the queue for a job whose upload is stored
+func reserve() error {
+	mu.Lock()
+	defer mu.Unlock()
+	if len(queue)+reserved >= maxQueued {
+		return ErrQueueFull
+	}
+	reserved++
+	return nil
+}
+
+// newJob stores the uploaded CSV file in a new job directory and returns the
+// job, which is not queued yet
+func newJob(r io.Reader, filename string, mapping Mapping, delimiter rune) (*Job, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	jobDir := filepath.Join(dir, id)
+	if err := os.MkdirAll(jobDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create job directory: %w", err)
+	}
+
+	job := &Job{
+		ID:        id,
+		State:     Queued,
+		Filename:  filepath.Base(filename),
+		Mapping:   mapping,
+		Delimiter: string(delimiter),
+		CreatedAt: time.Now().UTC(),
+	}
+	if job.RowsTotal, err = store(r, filepath.Join(jobDir, "input.csv"), mapping, delimiter); err == nil {
+		err = save(job)
+	}
+	if err != nil {
+		os.RemoveAll(jobDir)
+		return nil, err
+	}
+	return job, nil
+}
+
+// store copies the uploaded file to path and returns its number of data
+// rows. It fails with an InputError if the file isn't valid CSV or lacks
+// a mapped column.
+func store(r io.Reader, path string, mapping Mapping, delimiter rune) (int, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to store upload: %w", err)
+	}
+	defer f.Close()
+
+	reader := newReader(io.TeeReader(r, f), delimiter)
+	header, err := reader.Read()
+	if err != nil {
+		return 0, &InputError{fmt.Sprintf("failed to read header row: %v", err)}
+	}
+	if _, err := mapping.indexes(header); err != nil {
+		return 0, err
+	}
+
+	rows := 0
+	for {
+		_, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, &InputError{fmt.Sprintf("invalid CSV: %v", err)}
+		}
+		rows++
+	}
+	return rows, f.Close()
+}
+
+// InputError reports an uploaded file or mapping that cannot be processed
+type InputError struct {
+	Message string
+}
+
+func (e *InputError) Error() string {
+	return e.Message
+}
+
+// columns holds the header indexes of the mapped columns, -1 for unmapped ones
+type columns struct {
+	text, street, houseNumber, postcode, city int
+}
+
+// indexes looks up the mapped columns in the header row
+func (m Mapping) indexes(header []string) (columns, error) {
+	if m.Query == "" && m.Street == "" && m.HouseNumber == "" && m.Postcode == "" && m.City == "" {
+		return columns{}, &InputError{"no address column mapped"}
+	}
+	if m.Query != "" && (m.Street != "" || m.HouseNumber != "" || m.Postcode != "" || m.City != "") {
+		return columns{}, &InputError{"the free-text column must not be combined with structured columns"}
+	}
+
+	var missing []string
+	index := func(name string) int {
+		if name == "" {
+			return -1
+		}
+		for i, column := range header {
+			if strings.TrimSpace(column) == name {
+				return i
+			}
+		}
+		missing = append(missing, name)
+		return -1
+	}
+	c := columns{
+		text:        index(m.Query),
+		street:      index(m.Street),
+		houseNumber: index(m.HouseNumber),
+		postcode:    index(m.Postcode),
+		city:        index(m.City),
+	}
+	if len(missing) > 0 {
+		return columns{}, &InputError{fmt.Sprintf("columns not found in header row: %s", strings.Join(missing, ", "))}
+	}
+	return c, nil
+}
+
+// address returns the address of a data row
+func (c columns) address(record []string) Query {
+	field := func(i int) string {
+		if i < 0 || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+	return Query{
+		Text:        field(c.text),
+		Street:      field(c.street),
+		HouseNumber: field(c.houseNumber),
+		Postcode:    field(c.postcode),
+		City:        field(c.city),
+	}
+}
+
+// newReader returns a lenient CSV reader that skips a leading byte order mark
+func newReader(r io.Reader, delimiter rune) *csv.Reader {
+	reader := csv.NewReader(&bomSkipper{r: r})
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	return reader
+}
+
+// bomSkipper drops the UTF-8 byte order mark spreadsheet programs put in front of CSV exports
+type bomSkipper struct {
+	r       io.Reader
+	checked bool
+	buf     []byte
+}
+
+func (b *bomSkipper) Read(p []byte) (int, error) {
+	if !b.checked {
+		b.checked = true
+		head := make([]byte, 3)
+		n, err := io.ReadFull(b.r, head)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return 0, err
+		}
+		if n == 3 && string(head) == "\xef\xbb\xbf" {
+			n = 0
+		}
+		b.buf = head[:n]
+	}
+	if len(b.buf) > 0 {
+		n := copy(p, b.buf)
+		b.buf = b.buf[n:]
+		return n, nil
+	}
+	return b.r.Read(p)
+}
+
+// Get returns a copy of the job with the given ID
+func Get(id string) (*Job, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	job, ok := jobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	found := *job
+	return &found, nil
+}
+
+// ResultPath returns the path of the enriched CSV file of a finished job
+func ResultPath(id string) (string, error) {
+	job, err := Get(id)
+	if err != nil {
+		return "", err
+	}
+	if job.State != Done {
+		return "", ErrNotDone
+	}
+	return filepath.Join(dir, id, "output.csv"), nil
+}
+
+// Delete stops the job if it is running and removes it with all its files
+func Delete(id string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := jobs[id]; !ok {
+		return ErrNotFound
+	}
+	delete(jobs, id)
+	if cancel, ok := cancels[id]; ok {
+		cancel()
+	}
+	if err := os.RemoveAll(filepath.Join(dir, id)); err != nil {
+		return fmt.Errorf("failed to delete job: %w", err)
+	}
+	return nil
+}
+
+// save writes the job state to job.json
+func save(job *Job) error {
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode job: %w", err)
+	}
+	path := filepath.Join(dir, job.ID, "job.json")
+	// Write a temporary file first, so a crash never leaves a truncated job.json
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("failed to save job: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to save job: %w", err)
+	}
+	return nil
+}
+
+// newID returns a random job ID
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate job id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
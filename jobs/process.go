@@ -0,0 +1,235 @@
+package jobs
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// chunkSize is the number of rows geocoded before the progress is saved
+const chunkSize = 250
+
+// rowConcurrency is the number of rows of a job geocoded at the same time.
+// Jobs run in the background, so they leave capacity for interactive requests.
+const rowConcurrency = 4
+
+// resultColumns are appended to every row of the enriched file
+var resultColumns = []string{"geocoded_lat", "geocoded_lon", "geocoded_address", "geocoded_confidence", "geocoded_match_type", "geocoded_error"}
+
+// work processes the queued jobs one after another
+func work() {
+	for id := range queue {
+		mu.Lock()
+		job, ok := jobs[id]
+		if !ok {
+			// Deleted while it was queued
+			mu.Unlock()
+			continue
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancels[id] = cancel
+		job.State = Running
+		mu.Unlock()
+
+		log.Printf("Geocoding job %s started (%d rows).", id, job.RowsTotal)
+		err := process(ctx, job)
+
+		mu.Lock()
+		delete(cancels, id)
+		cancel()
+		if _, ok := jobs[id]; !ok {
+			// Deleted while it was running, its files are gone
+			mu.Unlock()
+			log.Printf("Geocoding job %s deleted.", id)
+			continue
+		}
+		now := time.Now().UTC()
+		job.FinishedAt = &now
+		if err != nil {
+			job.State = Failed
+			job.Error = err.Error()
+		} else {
+			job.State = Done
+		}
+		if err := save(job); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+		mu.Unlock()
+		log.Printf("Geocoding job %s %s.", id, job.State)
+	}
+}
+
+// process geocodes every row of the job's input file and writes the enriched
+// file. The progress is saved after every chunk of rows.
+func process(ctx context.Context, job *Job) error {
+	jobDir := filepath.Join(dir, job.ID)
+	in, err := os.Open(filepath.Join(jobDir, "input.csv"))
+	if err != nil {
+		return fmt.Errorf("failed to open input: %w", err)
+	}
+	defer in.Close()
+
+	// The result is written to a temporary file, output.csv only appears once it is complete
+	partPath := filepath.Join(jobDir, "output.csv.part")
+	out, err := os.Create(partPath)
+	if err != nil {
+		return fmt.Errorf("failed to create output: %w", err)
+	}
+	defer out.Close()
+
+	delimiter := firstRune(job.Delimiter)
+	reader := newReader(in, delimiter)
+	writer := csv.NewWriter(out)
+	writer.Comma = delimiter
+
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read header row: %w", err)
+	}
+	cols, err := job.Mapping.indexes(header)
+	if err != nil {
+		return err
+	}
+	if err := writer.Write(append(header, resultColumns...)); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+
+	for {
+		chunk, err := readChunk(reader, len(header))
+		if err != nil {
+			return err
+		}
+		if len(chunk) == 0 {
+			break
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		matched := 0
+		for _, row := range geocodeChunk(cols, chunk) {
+			if row.matched {
+				matched++
+			}
+			if err := writer.Write(row.record); err != nil {
+				return fmt.Errorf("failed to write output: %w", err)
+			}
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+
+		mu.Lock()
+		job.RowsProcessed += len(chunk)
+		job.RowsMatched += matched
+		err = save(job)
+		mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	if err := os.Rename(partPath, filepath.Join(jobDir, "output.csv")); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	return nil
+}
+
+// readChunk reads up to chunkSize rows, an empty chunk marks the end of the file.
+// Short rows are padded to width fields, so the result columns line up.
+func readChunk(reader *csv.Reader, width int) ([][]string, error) {
+	var chunk [][]string
+	for len(chunk) < chunkSize {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read input: %w", err)
+		}
+		for len(record) < width {
+			record = append(record, "")
+		}
+		chunk = append(chunk, record)
+	}
+	return chunk, nil
+}
+
+// enrichedRow is an input row with the result columns appended
+type enrichedRow struct {
+	record  []string
+	matched bool
+}
+
+// geocodeChunk geocodes the rows of a chunk concurrently and returns them
+// enriched, in input order
+func geocodeChunk(cols columns, chunk [][]string) []enrichedRow {
+	rows := make([]enrichedRow, len(chunk))
+	sem := make(chan struct{}, rowConcurrency)
+	var wg sync.WaitGroup
+	for i, record := range chunk {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			rows[i] = enrich(record, cols)
+		}()
+	}
+	wg.Wait()
+	return rows
+}
+
+// enrich geocodes a single row and appends the result columns
+func enrich(record []string, cols columns) enrichedRow {
+	q := cols.address(record)
+	if q == (Query{}) {
+		return enrichedRow{record: append(record, "", "", "", "", "", "no address")}
+	}
+
+	result, err := geocode(q)
+	if err != nil {
+		return enrichedRow{record: append(record, "", "", "", "", "", err.Error())}
+	}
+	if result.Address == nil {
+		return enrichedRow{record: append(record, "", "", "", "0", "", "")}
+	}
+
+	addr := result.Address
+	city := addr.City
+	if addr.Postcode != "" {
+		city = addr.Postcode + " " + city
+	}
+	return enrichedRow{
+		record: append(record,
+			strconv.FormatFloat(addr.Latitude, 'f', 7, 64),
+			strconv.FormatFloat(addr.Longitude, 'f', 7, 64),
+			strings.TrimSpace(addr.Street+" "+addr.HouseNumber)+", "+city,
+			strconv.FormatFloat(result.Confidence, 'f', 2, 64),
+			result.MatchType,
+			"",
+		),
+		matched: true,
+	}
+}
+
+// firstRune returns the first rune of s, a comma if s is empty
+func firstRune(s string) rune {
+	for _, r := range s {
+		return r
+	}
+	return ','
+}
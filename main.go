@@ -11,6 +11,8 @@ import (
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/danielgtaylor/huma/v2/adapters/humago"
 	"github.com/rs/cors"
+	"mnlr.de/addressserver/jobs"
+	"mnlr.de/addressserver/routes"
 	"mnlr.de/addressserver/specialroutes"
 	"mnlr.de/addressserver/sql"
 )
@@ -31,6 +33,11 @@ func main() {
 	if err := sql.Init(); err != nil {
 		panic("Failed to initialize database: " + err.Error())
 	}
+
+	// Resume the geocoding jobs of a previous run
+	if err := jobs.Init("./data/jobs", routes.GeocodeJobRow); err != nil {
+		panic("Failed to initialize jobs: " + err.Error())
+	}
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() {
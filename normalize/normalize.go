@@ -0,0 +1,60 @@
+// Package normalize folds the spelling variants of German addresses into one
+// canonical form, so "Hauptstr. 5", "Hauptstrasse 5" and "Hauptstraße 5" or
+// "Muenchen" and "München" compare equal. It is applied to search queries as
+// well as to the normalized fulltext index.
+package normalize
+
+import (
+	"strings"
+)
+
+// folding replaces umlauts and ß by their ASCII transcriptions. The combining
+// diaeresis covers umlauts written in decomposed form.
+var folding = strings.NewReplacer(
+	"ä", "ae", "ö", "oe", "ü", "ue",
+	"a\u0308", "ae", "o\u0308", "oe", "u\u0308", "ue",
+	"ß", "ss", "ẞ", "ss",
+)
+
+// abbreviation expands a common abbreviation at the end of a word
+type abbreviation struct {
+	suffix    string
+	expansion string
+	word      bool // Only expanded if it is the whole word
+}
+
+// abbreviations are checked in order, the first matching suffix wins.
+// Abbreviations without a trailing dot are only expanded as whole words, like
+// "Berliner Str", as many words end in these letters.
+var abbreviations = []abbreviation{
+	{"str.", "strasse", false},
+	{"str", "strasse", true},
+	{"pl.", "platz", false},
+	{"pl", "platz", true},
+	{"wg.", "weg", false},
+}
+
+// Text returns the canonical form of s. Every whitespace separated word is
+// normalized with Word, the words are joined by single spaces.
+func Text(s string) string {
+	words := strings.Fields(s)
+	for i, word := range words {
+		words[i] = Word(word)
+	}
+	return strings.Join(words, " ")
+}
+
+// Word returns the canonical form of a single word: lower case, with umlauts
+// and ß folded and a trailing street type abbreviation expanded.
+func Word(w string) string {
+	w = folding.Replace(strings.ToLower(w))
+	for _, a := range abbreviations {
+		if a.word && w != a.suffix {
+			continue
+		}
+		if strings.HasSuffix(w, a.suffix) {
+			return strings.TrimSuffix(w, a.suffix) + a.expansion
+		}
+	}
+	return w
+}
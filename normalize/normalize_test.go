@@ -0,0 +1,54 @@
+package normalize
+
+import "testing"
+
+func TestWord(t *testing.T) {
+	tests := []struct {
+		word string
+		want string
+	}{
+		{"Hauptstraße", "hauptstrasse"},
+		{"Hauptstrasse", "hauptstrasse"},
+		{"Hauptstr.", "hauptstrasse"},
+		{"Str.", "strasse"},
+		{"Str", "strasse"},
+		{"STR", "strasse"},
+		{"Hauptstra", "hauptstra"},
+		{"Hauptstr", "hauptstr"},
+		{"Marktpl.", "marktplatz"},
+		{"Pl", "platz"},
+		{"Apl", "apl"},
+		{"Waldwg.", "waldweg"},
+		{"München", "muenchen"},
+		{"Mu\u0308nchen", "muenchen"},
+		{"Muenchen", "muenchen"},
+		{"Gießen", "giessen"},
+		{"GROẞ", "gross"},
+		{"Öhringen", "oehringen"},
+		{"12a", "12a"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Word(tt.word); got != tt.want {
+			t.Errorf("Word(%q) = %q, want %q", tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestText(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Hauptstr. 5", "hauptstrasse 5"},
+		{"  Berliner   Str 12 ", "berliner strasse 12"},
+		{"Am Markt Pl", "am markt platz"},
+		{"Frankfurt am Main", "frankfurt am main"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Text(tt.text); got != tt.want {
+			t.Errorf("Text(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+// Package parse splits free-text German addresses like
+// "Hauptmarkt 1, 90403 Nürnberg" into their components.
+package parse
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	postcodePattern = regexp.MustCompile(`^\d{5}$`)
+	// House numbers with optional letter suffix and ranges: 12, 12a, 12-14, 12a-12c, 12/1
+	houseNumberPattern = regexp.MustCompile(`(?i)^\d{1,4}[a-z]?([-/]\d{1,4}[a-z]?)?$`)
+	houseNumberStart   = regexp.MustCompile(`^\d{1,4}`)
+)
+
+// maxHouseNumberTokens is the number of tokens a house number may span, e.g. "12 - 14 a"
+const maxHouseNumberTokens = 4
+
+// Components holds the parts of a free-text address. Parts that were not
+// recognized are empty, words that could not be assigned to a part are kept in Rest.
+type Components struct {
+	Street      string `json:"street,omitempty"`
+	HouseNumber string `json:"house_number,omitempty"`
+	Postcode    string `json:"postcode,omitempty"`
+	City        string `json:"city,omitempty"`
+	Rest        string `json:"rest,omitempty"`
+
+	// leading are the words in front of the house number taken as the street
+	// although nothing separated them from a city, see Relaxed
+	leading string
+}
+
+// Address parses a free-text address. Commas separate the street part from the
+// city part; without commas the street is taken from the words in front of the
+// house number and the city from the words after it or after the postcode.
+func Address(input string) Components {
+	var c Components
+	var rest []string
+	var pending [][]string // comma separated parts that weren't assigned yet
+
+	for _, part := range strings.Split(input, ",") {
+		tokens := strings.Fields(part)
+		if len(tokens) == 0 {
+			continue
+		}
+
+		p := -1
+		if c.Postcode == "" {
+			p = indexPostcode(tokens)
+		}
+		h0, h1 := -1, -1
+		if c.HouseNumber == "" {
+			h0, h1 = findHouseNumber(tokens, p)
+		}
+
+		switch {
+		case h0 >= 0:
+			c.HouseNumber = strings.ToLower(strings.Join(tokens[h0:h1], ""))
+			start := 0
+			if p >= 0 && p < h0 {
+				// "90403 Nürnberg Hauptmarkt 1": the city directly follows the postcode
+				rest = append(rest, tokens[:p]...)
+				c.Postcode = tokens[p]
+				start = p + 1
+				if h0-start > 1 {
+					c.City = tokens[start]
+					start++
+				}
+			}
+			c.Street = strings.Join(tokens[start:h0], " ")
+			if h0-start > 1 {
+				c.leading = c.Street
+			}
+
+			after := tokens[h1:]
+			if p > h0 {
+				// "Hauptmarkt 1 90403 Nürnberg"
+				rest = append(rest, tokens[h1:p]...)
+				c.Postcode = tokens[p]
+				after = tokens[p+1:]
+			}
+			if c.Street == "" {
+				// "1 Hauptmarkt"
+				c.Street = strings.Join(after, " ")
+			} else if c.City == "" {
+				c.City = strings.Join(after, " ")
+			} else {
+				rest = append(rest, after...)
+			}
+		case p >= 0:
+			// "90403 Nürnberg", words in front of the postcode are resolved later
+			c.Postcode = tokens[p]
+			c.City = strings.Join(tokens[p+1:], " ")
+			if p > 0 {
+				pending = append(pending, tokens[:p])
+			}
+		default:
+			pending = append(pending, tokens)
+		}
+	}
+
+	// Segments without house number or postcode complete a half known address,
+	// e.g. the city in "Nürnberg, Hauptmarkt 1" or the street in "Hauptmarkt, 90403 Nürnberg"
+	for _, tokens := range pending {
+		text := strings.Join(tokens, " ")
+		switch {
+		case c.City == "" && (c.Street != "" || c.HouseNumber != ""):
+			c.City = text
+		case c.Street == "" && c.City != "":
+			c.Street = text
+		default:
+			rest = append(rest, tokens...)
+		}
+	}
+
+	c.Rest = strings.Join(rest, " ")
+	return c
+}
+
+// Relaxed returns the components with the words in front of the house number
+// moved from Street to Rest, for queries like "Nürnberg Hauptmarkt 1" whose
+// leading words also contain the city. It reports false if the street wasn't
+// taken from several words in front of the house number.
+func (c Components) Relaxed() (Components, bool) {
+	if c.leading == "" {
+		return c, false
+	}
+	c.Street = strings.TrimSpace(strings.TrimPrefix(c.Street, c.leading))
+	c.Rest = strings.TrimSpace(c.leading + " " + c.Rest)
+	c.leading = ""
+	return c, true
+}
+
+// HouseNumbers returns the house numbers the parsed house number stands for:
+// the number itself and, for ranges like "12-14", both ends of the range.
+func (c Components) HouseNumbers() []string {
+	if c.HouseNumber == "" {
+		return nil
+	}
+	numbers := []string{c.HouseNumber}
+	if from, to, ok := strings.Cut(c.HouseNumber, "-"); ok {
+		numbers = append(numbers, from, to)
+	}
+	return numbers
+}
+
+// indexPostcode returns the index of the first token that is a postcode, or -1
+func indexPostcode(tokens []string) int {
+	for i, token := range tokens {
+		if postcodePattern.MatchString(token) {
+			return i
+		}
+	}
+	return -1
+}
+
+// findHouseNumber returns the token span [start, end) of the first house number,
+// skipping the postcode at index skip. A house number may be split over several
+// tokens like "12 a" or "12 - 14". It returns -1, -1 if there is none.
+func findHouseNumber(tokens []string, skip int) (int, int) {
+	for i, token := range tokens {
+		if i == skip || !houseNumberStart.MatchString(token) {
+			continue
+		}
+		// Take the longest run of tokens that still forms a house number
+		end := -1
+		candidate := ""
+		for j := i; j < len(tokens) && j < i+maxHouseNumberTokens && j != skip; j++ {
+			candidate += tokens[j]
+			if houseNumberPattern.MatchString(candidate) {
+				end = j + 1
+			}
+		}
+		if end > 0 {
+			return i, end
+		}
+	}
+	return -1, -1
+}
@@ -0,0 +1,73 @@
+package parse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAddress(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Components
+	}{
+		{"Hauptmarkt 1, 90403 Nürnberg", Components{Street: "Hauptmarkt", HouseNumber: "1", Postcode: "90403", City: "Nürnberg"}},
+		{"Hauptmarkt 1 90403 Nürnberg", Components{Street: "Hauptmarkt", HouseNumber: "1", Postcode: "90403", City: "Nürnberg"}},
+		{"Hauptmarkt 1 Nürnberg", Components{Street: "Hauptmarkt", HouseNumber: "1", City: "Nürnberg"}},
+		{"90403 Nürnberg Hauptmarkt 1", Components{Street: "Hauptmarkt", HouseNumber: "1", Postcode: "90403", City: "Nürnberg"}},
+		{"Nürnberg, Hauptmarkt 1", Components{Street: "Hauptmarkt", HouseNumber: "1", City: "Nürnberg"}},
+		{"Hauptmarkt, 90403 Nürnberg", Components{Street: "Hauptmarkt", Postcode: "90403", City: "Nürnberg"}},
+		{"1 Hauptmarkt", Components{Street: "Hauptmarkt", HouseNumber: "1"}},
+		{"Frankfurter Allee 12a", Components{Street: "Frankfurter Allee", HouseNumber: "12a", leading: "Frankfurter Allee"}},
+		{"Nürnberg Hauptmarkt 1", Components{Street: "Nürnberg Hauptmarkt", HouseNumber: "1", leading: "Nürnberg Hauptmarkt"}},
+		{"Hauptstraße 12 - 14", Components{Street: "Hauptstraße", HouseNumber: "12-14"}},
+		{"Hauptstraße 12 A", Components{Street: "Hauptstraße", HouseNumber: "12a"}},
+		{"Hauptstraße 12/1", Components{Street: "Hauptstraße", HouseNumber: "12/1"}},
+		{"90403", Components{Postcode: "90403"}},
+		{"90403 Nürnberg", Components{Postcode: "90403", City: "Nürnberg"}},
+		{"Nürnberg", Components{Rest: "Nürnberg"}},
+		{"Hauptmarkt Nürnberg", Components{Rest: "Hauptmarkt Nürnberg"}},
+		{"", Components{}},
+		{" , ", Components{}},
+	}
+	for _, tt := range tests {
+		if got := Address(tt.input); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Address(%q) = %+v, want %+v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestRelaxed(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Components
+		ok    bool
+	}{
+		{"Nürnberg Hauptmarkt 1", Components{HouseNumber: "1", Rest: "Nürnberg Hauptmarkt"}, true},
+		{"90403 Fürth Nürnberg Hauptmarkt 1", Components{HouseNumber: "1", Postcode: "90403", City: "Fürth", Rest: "Nürnberg Hauptmarkt"}, true},
+		{"Hauptmarkt 1 Nürnberg", Components{Street: "Hauptmarkt", HouseNumber: "1", City: "Nürnberg"}, false},
+		{"Nürnberg, Bahnhofstraße 3", Components{Street: "Bahnhofstraße", HouseNumber: "3", City: "Nürnberg"}, false},
+	}
+	for _, tt := range tests {
+		got, ok := Address(tt.input).Relaxed()
+		if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Address(%q).Relaxed() = %+v, %v, want %+v, %v", tt.input, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestHouseNumbers(t *testing.T) {
+	tests := []struct {
+		houseNumber string
+		want        []string
+	}{
+		{"", nil},
+		{"12", []string{"12"}},
+		{"12a", []string{"12a"}},
+		{"12-14", []string{"12-14", "12", "14"}},
+	}
+	for _, tt := range tests {
+		if got := (Components{HouseNumber: tt.houseNumber}).HouseNumbers(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("HouseNumbers(%q) = %v, want %v", tt.houseNumber, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package parse
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Fields that words and phrases of a query can be restricted to with "field:"
+var fields = map[string]bool{"street": true, "house_number": true, "postcode": true, "city": true}
+
+// Alternative is one of the parts of a search query separated by OR. An
+// address matches it if it matches the components, all phrases and none of
+// the excluded phrases.
+type Alternative struct {
+	Components          // The plain words split by Address plus the words given with a field
+	Phrases    []Phrase // Quoted phrases
+	Excluded   []Phrase // Words and phrases preceded by -
+}
+
+// Phrase is a quoted phrase or an excluded word, matched exactly
+type Phrase struct {
+	Field string `json:"field,omitempty"` // Empty for all fields
+	Text  string `json:"text"`
+}
+
+// Query parses a search query. Besides plain words the query may contain
+//
+//   - "quoted phrases", whose words must appear exactly and in this order
+//   - field:word or field:"phrase" to match only the street, house_number, postcode or city
+//   - -word, -"phrase" or -field:word to exclude addresses
+//   - OR between two groups of words, e.g. "Hauptmarkt Nürnberg OR Königstraße Fürth"
+//
+// The plain words of each alternative are split into address components by
+// Address. Malformed queries, like an unterminated quote or an alternative of
+// excluded words only, return an error describing the problem.
+func Query(input string) ([]Alternative, error) {
+	type group struct {
+		words    []string
+		fielded  []Phrase // Words given with a field, merged into the components
+		phrases  []Phrase
+		excluded []Phrase
+	}
+	groups := []group{{}}
+
+	runes := []rune(input)
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+		start := i
+		g := &groups[len(groups)-1]
+
+		// A minus directly in front of a word excludes it, a lone one is a
+		// plain word like in the house number range "12 - 14"
+		exclude := runes[i] == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1])
+		if exclude {
+			i++
+		}
+
+		// An optional field name in front of the word or phrase
+		field := ""
+		if j := fieldEnd(runes, i); j > i {
+			name := strings.ToLower(string(runes[i:j]))
+			if !fields[name] {
+				return nil, fmt.Errorf("unknown field %q, use street, house_number, postcode or city", name)
+			}
+			field = name
+			i = j + 1 // Skip the colon
+			if i == len(runes) || unicode.IsSpace(runes[i]) {
+				return nil, fmt.Errorf("%s: needs a word or a quoted phrase", field)
+			}
+		}
+
+		var text string
+		quoted := runes[i] == '"'
+		if quoted {
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, errors.New("unterminated quote, phrases must be enclosed in a pair of quotes")
+			}
+			text = strings.Join(strings.Fields(string(runes[i+1:end])), " ")
+			if text == "" {
+				return nil, errors.New("empty phrase")
+			}
+			i = end + 1
+		} else {
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) {
+				end++
+			}
+			text = string(runes[i:end])
+			i = end
+		}
+
+		switch {
+		case text == "OR" && !quoted && !exclude && field == "":
+			if len(g.words) == 0 && len(g.fielded) == 0 && len(g.phrases) == 0 && len(g.excluded) == 0 {
+				return nil, errors.New("OR must be placed between two words or phrases")
+			}
+			groups = append(groups, group{})
+		case exclude:
+			g.excluded = append(g.excluded, Phrase{Field: field, Text: text})
+		case quoted:
+			g.phrases = append(g.phrases, Phrase{Field: field, Text: text})
+		case field != "":
+			g.fielded = append(g.fielded, Phrase{Field: field, Text: text})
+		default:
+			g.words = append(g.words, string(runes[start:i]))
+		}
+	}
+
+	var alternatives []Alternative
+	for _, g := range groups {
+		if len(g.words) == 0 && len(g.fielded) == 0 && len(g.phrases) == 0 {
+			if len(g.excluded) > 0 {
+				return nil, errors.New("a query must contain words or phrases besides the excluded ones")
+			}
+			if len(groups) > 1 {
+				return nil, errors.New("OR must be placed between two words or phrases")
+			}
+			return nil, errors.New("the query is empty")
+		}
+
+		alt := Alternative{
+			Components: Address(strings.Join(g.words, " ")),
+			Phrases:    g.phrases,
+			Excluded:   g.excluded,
+		}
+		for _, f := range g.fielded {
+			if err := alt.Components.add(f.Field, f.Text); err != nil {
+				return nil, err
+			}
+		}
+		alternatives = append(alternatives, alt)
+	}
+	return alternatives, nil
+}
+
+// Plain reports whether the alternative consists of plain and fielded words only
+func (a Alternative) Plain() bool {
+	return len(a.Phrases) == 0 && len(a.Excluded) == 0
+}
+
+// WithPhrases returns the components with the words of the phrases added,
+// unrestricted phrases as Rest. It describes what an address matching the
+// alternative contains.
+func (a Alternative) WithPhrases() Components {
+	c := a.Components
+	for _, p := range a.Phrases {
+		if p.Field == "" {
+			c.Rest = strings.TrimSpace(c.Rest + " " + p.Text)
+			continue
+		}
+		// A second house number or postcode is left out
+		_ = c.add(p.Field, p.Text)
+	}
+	return c
+}
+
+// add appends a word given with a field to its component. A house number or
+// postcode can only be given once.
+func (c *Components) add(field, word string) error {
+	appendTo := func(s *string) {
+		*s = strings.TrimSpace(*s + " " + word)
+	}
+	switch field {
+	case "street":
+		appendTo(&c.Street)
+	case "city":
+		appendTo(&c.City)
+	case "house_number":
+		if c.HouseNumber != "" {
+			return errors.New("more than one house number given")
+		}
+		c.HouseNumber = strings.ToLower(word)
+	case "postcode":
+		if c.Postcode != "" {
+			return errors.New("more than one postcode given")
+		}
+		c.Postcode = word
+	}
+	return nil
+}
+
+// fieldEnd returns the index of the colon ending a field name that starts at
+// start, or -1 if there is none
+func fieldEnd(runes []rune, start int) int {
+	i := start
+	for i < len(runes) && (unicode.IsLetter(runes[i]) || runes[i] == '_') {
+		i++
+	}
+	if i == start || i == len(runes) || runes[i] != ':' {
+		return -1
+	}
+	return i
+}
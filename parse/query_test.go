@@ -0,0 +1,119 @@
+package parse
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestQuery(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []Alternative
+	}{
+		{"Hauptmarkt 1 Nürnberg", []Alternative{
+			{Components: Components{Street: "Hauptmarkt", HouseNumber: "1", City: "Nürnberg"}},
+		}},
+		{`"Frankfurter Allee" 12`, []Alternative{
+			{Components: Components{HouseNumber: "12"}, Phrases: []Phrase{{Text: "Frankfurter Allee"}}},
+		}},
+		{`"  Frankfurter   Allee "`, []Alternative{
+			{Phrases: []Phrase{{Text: "Frankfurter Allee"}}},
+		}},
+		{"street:Hauptmarkt city:Nürnberg", []Alternative{
+			{Components: Components{Street: "Hauptmarkt", City: "Nürnberg"}},
+		}},
+		{`city:"Frankfurt am Main" Zeil`, []Alternative{
+			{Components: Components{Rest: "Zeil"}, Phrases: []Phrase{{Field: "city", Text: "Frankfurt am Main"}}},
+		}},
+		{"Hauptmarkt postcode:90403 house_number:5A", []Alternative{
+			{Components: Components{HouseNumber: "5a", Postcode: "90403", Rest: "Hauptmarkt"}},
+		}},
+		{"STREET:Hauptmarkt", []Alternative{
+			{Components: Components{Street: "Hauptmarkt"}},
+		}},
+		{"Hauptmarkt -Fürth", []Alternative{
+			{Components: Components{Rest: "Hauptmarkt"}, Excluded: []Phrase{{Text: "Fürth"}}},
+		}},
+		{`Hauptmarkt -city:"Bad Homburg" -street:Nebenmarkt`, []Alternative{
+			{Components: Components{Rest: "Hauptmarkt"}, Excluded: []Phrase{{Field: "city", Text: "Bad Homburg"}, {Field: "street", Text: "Nebenmarkt"}}},
+		}},
+		{"Hauptstraße 12 - 14", []Alternative{
+			{Components: Components{Street: "Hauptstraße", HouseNumber: "12-14"}},
+		}},
+		{"Hauptmarkt Nürnberg OR Königstraße Fürth", []Alternative{
+			{Components: Components{Rest: "Hauptmarkt Nürnberg"}},
+			{Components: Components{Rest: "Königstraße Fürth"}},
+		}},
+		{`"Hauptmarkt" OR city:Fürth OR Zeil`, []Alternative{
+			{Phrases: []Phrase{{Text: "Hauptmarkt"}}},
+			{Components: Components{City: "Fürth"}},
+			{Components: Components{Rest: "Zeil"}},
+		}},
+		{`Hauptmarkt or Fürth "OR"`, []Alternative{
+			{Components: Components{Rest: "Hauptmarkt or Fürth"}, Phrases: []Phrase{{Text: "OR"}}},
+		}},
+	}
+	for _, tt := range tests {
+		got, err := Query(tt.input)
+		if err != nil {
+			t.Errorf("Query(%q) failed: %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Query(%q) = %+v, want %+v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string // Part of the error message
+	}{
+		{"", "empty"},
+		{"   ", "empty"},
+		{`"Hauptmarkt`, "unterminated quote"},
+		{`Hauptmarkt "1`, "unterminated quote"},
+		{`""`, "empty phrase"},
+		{`street:"  "`, "empty phrase"},
+		{"street: Hauptmarkt", "needs a word"},
+		{"Hauptmarkt city:", "needs a word"},
+		{"country:Deutschland", "unknown field"},
+		{"-Fürth", "besides the excluded"},
+		{`-"Bad Homburg" -city:Fürth`, "besides the excluded"},
+		{"OR Hauptmarkt", "OR must be placed"},
+		{"Hauptmarkt OR", "OR must be placed"},
+		{"Hauptmarkt OR OR Zeil", "OR must be placed"},
+		{"Hauptmarkt OR -Fürth", "besides the excluded"},
+		{"house_number:1 house_number:2", "more than one house number"},
+		{"Hauptmarkt 1 house_number:2", "more than one house number"},
+		{"postcode:90403 postcode:90402", "more than one postcode"},
+	}
+	for _, tt := range tests {
+		_, err := Query(tt.input)
+		if err == nil {
+			t.Errorf("Query(%q) succeeded, want an error containing %q", tt.input, tt.want)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Query(%q) error = %q, want it to contain %q", tt.input, err, tt.want)
+		}
+	}
+}
+
+func TestAlternativeWithPhrases(t *testing.T) {
+	alternatives, err := Query(`"Frankfurter Allee" 12 city:"Berlin" house_number:"14"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alt := alternatives[0]
+	if alt.Plain() {
+		t.Error("Plain() = true for an alternative with phrases")
+	}
+	// The second house number from the phrase is left out
+	want := Components{HouseNumber: "12", City: "Berlin", Rest: "Frankfurter Allee"}
+	if got := alt.WithPhrases(); !reflect.DeepEqual(got, want) {
+		t.Errorf("WithPhrases() = %+v, want %+v", got, want)
+	}
+}
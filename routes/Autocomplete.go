@@ -0,0 +1,168 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/danielgtaylor/huma/v2"
+	"mnlr.de/addressserver/normalize"
+	"mnlr.de/addressserver/parse"
+	"mnlr.de/addressserver/sql"
+)
+
+// autocompleteWindow is the number of distinct streets the suggestions are picked from
+const autocompleteWindow = 200
+
+// AutocompleteInput represents the input for address autocompletion.
+type AutocompleteInput struct {
+	Query string `query:"q" example:"Hauptstr Nürn" doc:"The partially typed address"`
+	Limit int    `query:"limit" default:"10" minimum:"1" maximum:"50" doc:"Maximum number of suggestions to return"`
+}
+
+// Suggestion represents a single autocomplete suggestion.
+type Suggestion struct {
+	Type    string       `json:"type" enum:"city,street,address" doc:"Whether the suggestion is a city, a street in a city or a concrete address"`
+	Label   string       `json:"label" example:"Hauptmarkt, Nürnberg" doc:"Text to display and to fill into the search field"`
+	Street  string       `json:"street,omitempty" doc:"Street, not set for cities"`
+	City    string       `json:"city" doc:"City"`
+	Address *sql.Address `json:"address,omitempty" doc:"The address, only set for type address"`
+}
+
+// AutocompleteOutput represents the autocomplete operation response.
+type AutocompleteOutput struct {
+	Body struct {
+		Suggestions []Suggestion `json:"suggestions" doc:"Suggestions, cities first, then streets or addresses"`
+	}
+}
+
+// Autocomplete suggests cities and streets for a partially typed address, and
+// concrete addresses as soon as a house number is typed.
+func Autocomplete(ctx context.Context, input *AutocompleteInput) (*AutocompleteOutput, error) {
+	query := strings.TrimSpace(input.Query)
+	if query == "" {
+		return nil, huma.Error400BadRequest("search query cannot be empty")
+	}
+
+	parsed := parse.Address(query)
+	columns := componentsQuery(parsed)
+	columns.HouseNumberPrefix = true
+
+	var suggestions []Suggestion
+	var err error
+	if parsed.HouseNumber != "" {
+		suggestions, err = addressSuggestions(columns, parsed.HouseNumber, input.Limit)
+		// Like /api/search, retry with the words in front of the house number unrestricted
+		if retry, ok := parsed.Relaxed(); ok && err == nil && len(suggestions) == 0 {
+			columns = componentsQuery(retry)
+			columns.HouseNumberPrefix = true
+			suggestions, err = addressSuggestions(columns, parsed.HouseNumber, input.Limit)
+		}
+	} else {
+		suggestions, err = streetSuggestions(query, columns, input.Limit)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("autocomplete failed: %w", err)
+	}
+
+	resp := &AutocompleteOutput{}
+	resp.Body.Suggestions = suggestions
+	return resp, nil
+}
+
+// addressSuggestions suggests the best matching concrete addresses, the ones
+// with exactly the typed house number first.
+func addressSuggestions(columns sql.ColumnQuery, houseNumber string, limit int) ([]Suggestion, error) {
+	matches, _, err := sql.ColumnSearch(columns, sql.SearchOptions{Limit: autocompleteWindow})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return strings.EqualFold(matches[i].Address.HouseNumber, houseNumber) &&
+			!strings.EqualFold(matches[j].Address.HouseNumber, houseNumber)
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	var suggestions []Suggestion
+	for _, m := range matches {
+		addr := m.Address
+		city := addr.City
+		if addr.Postcode != "" {
+			city = addr.Postcode + " " + city
+		}
+		suggestions = append(suggestions, Suggestion{
+			Type:    "address",
+			Label:   fmt.Sprintf("%s %s, %s", addr.Street, addr.HouseNumber, city),
+			Street:  addr.Street,
+			City:    addr.City,
+			Address: &addr,
+		})
+	}
+	return suggestions, nil
+}
+
+// streetSuggestions groups the matching streets into cities, when the query
+// only matches the city name, and streets within a city otherwise.
+func streetSuggestions(query string, columns sql.ColumnQuery, limit int) ([]Suggestion, error) {
+	streets, err := sql.MatchingStreets(columns, autocompleteWindow)
+	if err != nil {
+		return nil, err
+	}
+
+	words := strings.Fields(normalize.Text(query))
+	seen := make(map[string]bool)
+	var cities, streetsInCity []Suggestion
+	for _, s := range streets {
+		if matchesAllWords(s.City, words) {
+			if !seen[s.City] {
+				seen[s.City] = true
+				cities = append(cities, Suggestion{Type: "city", Label: s.City, City: s.City})
+			}
+			continue
+		}
+		label := s.Street + ", " + s.City
+		if !seen[label] {
+			seen[label] = true
+			streetsInCity = append(streetsInCity, Suggestion{Type: "street", Label: label, Street: s.Street, City: s.City})
+		}
+	}
+
+	// Shorter city names are the closer matches for the typed prefix
+	sort.SliceStable(cities, func(i, j int) bool {
+		if len(cities[i].City) != len(cities[j].City) {
+			return len(cities[i].City) < len(cities[j].City)
+		}
+		return cities[i].City < cities[j].City
+	})
+	sort.SliceStable(streetsInCity, func(i, j int) bool {
+		return streetsInCity[i].Label < streetsInCity[j].Label
+	})
+
+	suggestions := append(cities, streetsInCity...)
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions, nil
+}
+
+// matchesAllWords reports whether every normalized word is a prefix of a word of text.
+func matchesAllWords(text string, words []string) bool {
+	tokens := strings.Fields(normalize.Text(text))
+	for _, word := range words {
+		found := false
+		for _, token := range tokens {
+			if strings.HasPrefix(token, word) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
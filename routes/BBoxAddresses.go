@@ -0,0 +1,51 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/danielgtaylor/huma/v2"
+	"mnlr.de/addressserver/sql"
+)
+
+// BBoxAddressesInput represents the input for the addresses of a map viewport.
+type BBoxAddressesInput struct {
+	BBox   string `query:"bbox" required:"true" example:"11.03,49.42,11.12,49.48" doc:"Box to return the addresses of, given as minLon,minLat,maxLon,maxLat"`
+	Limit  int    `query:"limit" default:"500" minimum:"1" maximum:"5000" doc:"Maximum number of results per page"`
+	Cursor string `query:"cursor" doc:"Token from the next field of a previous response to fetch the following page"`
+}
+
+// BBoxAddressesOutput represents the addresses inside a box.
+type BBoxAddressesOutput struct {
+	Body struct {
+		Addresses []sql.Address `json:"addresses" doc:"Addresses inside the box, ordered by ID"`
+		Truncated bool          `json:"truncated" doc:"Whether the box contains more addresses than returned"`
+		Next      string        `json:"next,omitempty" doc:"Cursor for the next page, absent on the last page"`
+	}
+}
+
+// BBoxAddresses returns the addresses inside a bounding box, e.g. the visible
+// area of a map.
+func BBoxAddresses(ctx context.Context, input *BBoxAddressesInput) (*BBoxAddressesOutput, error) {
+	box, err := parseBBox(input.BBox)
+	if err != nil {
+		return nil, huma.Error400BadRequest(err.Error())
+	}
+	after, err := sql.DecodeCursor(input.Cursor)
+	if err != nil {
+		return nil, huma.Error400BadRequest(err.Error())
+	}
+
+	addresses, next, truncated, err := sql.FindAddressesInBBox(*box, after, input.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("bbox search failed: %w", err)
+	}
+
+	resp := &BBoxAddressesOutput{}
+	resp.Body.Addresses = addresses
+	resp.Body.Truncated = truncated
+	if next != nil {
+		resp.Body.Next = next.Encode()
+	}
+	return resp, nil
+}
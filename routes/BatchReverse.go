@@ -0,0 +1,84 @@
+package routes
+
+import (
+	"context"
+
+	"github.com/danielgtaylor/huma/v2"
+	"mnlr.de/addressserver/sql"
+)
+
+// BatchPoint is a single coordinate of a batch reverse geocoding request.
+type BatchPoint struct {
+	ID        string  `json:"id,omitempty" example:"vehicle-7" doc:"Optional identifier echoed in the result"`
+	Latitude  float64 `json:"lat" example:"49.4521" doc:"Latitude coordinate"`
+	Longitude float64 `json:"lon" example:"11.0767" doc:"Longitude coordinate"`
+	RadiusKm  float64 `json:"radius,omitempty" minimum:"0.01" maximum:"10.0" doc:"Search radius in kilometers, defaults to the radius parameter"`
+	Limit     int     `json:"limit,omitempty" minimum:"1" maximum:"100" doc:"Maximum number of addresses, defaults to the limit parameter"`
+}
+
+// BatchReverseInput represents the input for batch reverse geocoding.
+type BatchReverseInput struct {
+	RadiusKm float64 `query:"radius" default:"1.0" minimum:"0.01" maximum:"10.0" doc:"Search radius in kilometers for points without their own radius"`
+	Limit    int     `query:"limit" default:"1" minimum:"1" maximum:"100" doc:"Maximum number of addresses for points without their own limit"`
+	Sort     string  `query:"sort" default:"distance" enum:"distance,house_number" doc:"Order of the addresses of each point: nearest first, or by street and house number"`
+	Body     struct {
+		Points []BatchPoint `json:"points" minItems:"1" maxItems:"1000" doc:"Coordinates to reverse geocode"`
+	}
+}
+
+// BatchReverseResult represents the outcome for a single point of a batch reverse geocoding request.
+type BatchReverseResult struct {
+	Index     int             `json:"index" doc:"Position of the point in the request"`
+	ID        string          `json:"id,omitempty" doc:"Identifier of the point, if one was given"`
+	Addresses []ReverseResult `json:"addresses" doc:"Addresses near the point in the requested order"`
+	Error     string          `json:"error,omitempty" doc:"Why the point failed, the other points are not affected"`
+}
+
+// BatchReverseOutput represents the batch reverse geocoding operation response.
+type BatchReverseOutput struct {
+	Body struct {
+		Results []BatchReverseResult `json:"results" doc:"One result per point, in request order"`
+	}
+}
+
+// BatchReverse reverse geocodes many coordinates in one request. The points
+// are processed concurrently, an invalid or failing point is reported in its
+// result instead of failing the whole batch.
+func BatchReverse(ctx context.Context, input *BatchReverseInput) (*BatchReverseOutput, error) {
+	if err := checkFinite("radius", input.RadiusKm); err != nil {
+		return nil, huma.Error400BadRequest(err.Error())
+	}
+	points := input.Body.Points
+	results := make([]BatchReverseResult, len(points))
+	for i, p := range points {
+		results[i] = BatchReverseResult{Index: i, ID: p.ID, Addresses: []ReverseResult{}}
+	}
+
+	runBatch(ctx, len(points), func(i int) {
+		p := points[i]
+		if err := checkCoordinate(p.Latitude, p.Longitude); err != nil {
+			results[i].Error = err.Error()
+			return
+		}
+		radiusKm, limit := p.RadiusKm, p.Limit
+		if radiusKm == 0 {
+			radiusKm = input.RadiusKm
+		}
+		if limit == 0 {
+			limit = input.Limit
+		}
+
+		addresses, distances, _, err := sql.FindAddressesInRadius(p.Latitude, p.Longitude, radiusKm, nil, limit)
+		if err != nil {
+			results[i].Error = err.Error()
+			return
+		}
+		results[i].Addresses = newReverseResults(addresses, distances, p.Latitude, p.Longitude, input.Sort)
+	}, func(i int, err error) {
+		results[i].Error = err.Error()
+	})
+
+	resp := &BatchReverseOutput{}
+	resp.Body.Results = results
+	return resp, nil
+}
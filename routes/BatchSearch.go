@@ -0,0 +1,143 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"mnlr.de/addressserver/jobs"
+	"mnlr.de/addressserver/parse"
+	"mnlr.de/addressserver/sql"
+)
+
+var (
+	errBatchQueryEmpty = errors.New("either q or at least one of street, house_number, postcode or city must be set")
+	errBatchQueryMixed = errors.New("q must not be combined with street, house_number, postcode or city")
+)
+
+// BatchQuery is a single query of a batch search, either free text or structured.
+type BatchQuery struct {
+	ID          string `json:"id,omitempty" example:"customer-42" doc:"Optional identifier echoed in the result"`
+	Query       string `json:"q,omitempty" example:"Hauptmarkt 1, 90403 Nürnberg" doc:"Free-text query, must not be combined with the structured fields"`
+	Street      string `json:"street,omitempty" doc:"Street name"`
+	HouseNumber string `json:"house_number,omitempty" doc:"House number, matched exactly"`
+	Postcode    string `json:"postcode,omitempty" doc:"Postcode, matched exactly, ignored if the database has no postcodes"`
+	City        string `json:"city,omitempty" doc:"City name"`
+}
+
+// BatchSearchInput represents the input for a batch search.
+type BatchSearchInput struct {
+	Alternatives int `query:"alternatives" default:"2" minimum:"0" maximum:"10" doc:"Number of alternative matches returned per query besides the best match"`
+	Body         struct {
+		Queries []BatchQuery `json:"queries" minItems:"1" maxItems:"1000" doc:"Queries to geocode"`
+	}
+}
+
+// BatchSearchResult represents the outcome of a single query of a batch search.
+type BatchSearchResult struct {
+	Index        int            `json:"index" doc:"Position of the query in the request"`
+	ID           string         `json:"id,omitempty" doc:"Identifier of the query, if one was given"`
+	Match        *SearchResult  `json:"match,omitempty" doc:"Best match, absent if nothing was found or the query failed"`
+	Alternatives []SearchResult `json:"alternatives,omitempty" doc:"Further matches in ranking order"`
+	Error        string         `json:"error,omitempty" doc:"Why the query failed, the other queries are not affected"`
+}
+
+// BatchSearchOutput represents the batch search operation response.
+type BatchSearchOutput struct {
+	Body struct {
+		Results []BatchSearchResult `json:"results" doc:"One result per query, in request order"`
+	}
+}
+
+// BatchSearch geocodes many free-text or structured queries in one request.
+// The queries are processed concurrently, a failing query is reported in its
+// result instead of failing the whole batch.
+func BatchSearch(ctx context.Context, input *BatchSearchInput) (*BatchSearchOutput, error) {
+	queries := input.Body.Queries
+	results := make([]BatchSearchResult, len(queries))
+	for i, q := range queries {
+		results[i] = BatchSearchResult{Index: i, ID: q.ID}
+	}
+
+	runBatch(ctx, len(queries), func(i int) {
+		parsed, matches, err := batchQuery(queries[i], 1+input.Alternatives)
+		if err != nil {
+			results[i].Error = err.Error()
+			return
+		}
+		for j, m := range matches {
+			result := SearchResult{Address: m.Address}
+			rate(&result, parsed)
+			if j == 0 {
+				results[i].Match = &result
+			} else {
+				results[i].Alternatives = append(results[i].Alternatives, result)
+			}
+		}
+	}, func(i int, err error) {
+		results[i].Error = err.Error()
+	})
+
+	resp := &BatchSearchOutput{}
+	resp.Body.Results = results
+	return resp, nil
+}
+
+// batchQuery runs a single batch query like /api/search does, structured
+// queries are matched column by column like a parsed free-text query.
+// It returns the query components together with the matches.
+func batchQuery(q BatchQuery, limit int) (parse.Components, []sql.HighlightedMatch, error) {
+	var parsed parse.Components
+	structured := parse.Components{
+		Street:      strings.TrimSpace(q.Street),
+		HouseNumber: strings.ToLower(strings.TrimSpace(q.HouseNumber)),
+		Postcode:    strings.TrimSpace(q.Postcode),
+		City:        strings.TrimSpace(q.City),
+	}
+	switch {
+	case strings.TrimSpace(q.Query) != "" && structured != (parse.Components{}):
+		return parsed, nil, errBatchQueryMixed
+	case strings.TrimSpace(q.Query) != "":
+		parsed = parse.Address(q.Query)
+	case structured != (parse.Components{}):
+		parsed = structured
+	default:
+		return parsed, nil, errBatchQueryEmpty
+	}
+
+	opts := sql.SearchOptions{Limit: limit}
+	matches, _, err := sql.ColumnSearch(componentsQuery(parsed), opts)
+	if err != nil || len(matches) > 0 {
+		return parsed, matches, err
+	}
+	// Like /api/search, retry with the words in front of the house number unrestricted
+	if retry, ok := parsed.Relaxed(); ok {
+		retryMatches, _, err := sql.ColumnSearch(componentsQuery(retry), opts)
+		if err != nil || len(retryMatches) > 0 {
+			return retry, retryMatches, err
+		}
+	}
+	return parsed, matches, nil
+}
+
+// GeocodeJobRow geocodes a row of a CSV geocoding job like a batch query
+// and rates the best match.
+func GeocodeJobRow(q jobs.Query) (jobs.Result, error) {
+	parsed, matches, err := batchQuery(BatchQuery{
+		Query:       q.Text,
+		Street:      q.Street,
+		HouseNumber: q.HouseNumber,
+		Postcode:    q.Postcode,
+		City:        q.City,
+	}, 1)
+	if err != nil || len(matches) == 0 {
+		return jobs.Result{}, err
+	}
+	result := SearchResult{Address: matches[0].Address}
+	rate(&result, parsed)
+	return jobs.Result{
+		Address:    &matches[0].Address,
+		Confidence: result.Confidence,
+		MatchType:  result.MatchType,
+	}, nil
+}
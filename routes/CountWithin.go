@@ -0,0 +1,38 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/danielgtaylor/huma/v2"
+	"mnlr.de/addressserver/sql"
+)
+
+// CountWithinInput represents the input for counting the addresses inside an area.
+type CountWithinInput struct {
+	Body GeoJSONGeometry
+}
+
+// CountWithinOutput represents the number of addresses inside an area.
+type CountWithinOutput struct {
+	Body struct {
+		Count int64 `json:"count" doc:"Number of addresses inside the area"`
+	}
+}
+
+// CountWithin counts the addresses inside a GeoJSON Polygon or MultiPolygon.
+func CountWithin(ctx context.Context, input *CountWithinInput) (*CountWithinOutput, error) {
+	area, err := input.Body.area()
+	if err != nil {
+		return nil, huma.Error400BadRequest(err.Error())
+	}
+
+	count, err := sql.CountAddressesWithin(area)
+	if err != nil {
+		return nil, fmt.Errorf("area count failed: %w", err)
+	}
+
+	resp := &CountWithinOutput{}
+	resp.Body.Count = count
+	return resp, nil
+}
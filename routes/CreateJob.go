@@ -0,0 +1,57 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/danielgtaylor/huma/v2"
+	"mnlr.de/addressserver/jobs"
+)
+
+// delimiters maps the delimiter parameter to the CSV field separator
+var delimiters = map[string]rune{"comma": ',', "semicolon": ';', "tab": '\t'}
+
+// CreateJobInput represents the upload of a CSV file to geocode.
+type CreateJobInput struct {
+	QueryColumn       string `query:"q_column" example:"Adresse" doc:"Column holding the complete address as free text, must not be combined with the other columns"`
+	StreetColumn      string `query:"street_column" example:"Straße" doc:"Column holding the street"`
+	HouseNumberColumn string `query:"house_number_column" example:"Hausnummer" doc:"Column holding the house number"`
+	PostcodeColumn    string `query:"postcode_column" example:"PLZ" doc:"Column holding the postcode"`
+	CityColumn        string `query:"city_column" example:"Ort" doc:"Column holding the city"`
+	Delimiter         string `query:"delimiter" default:"comma" enum:"comma,semicolon,tab" doc:"Field separator of the CSV file, also used for the result"`
+	RawBody           huma.MultipartFormFiles[struct {
+		File huma.FormFile `form:"file" contentType:"text/csv,text/plain" required:"true" doc:"CSV file with a header row"`
+	}]
+}
+
+// JobOutput represents the state of a geocoding job.
+type JobOutput struct {
+	Body jobs.Job
+}
+
+// CreateJob stores an uploaded CSV file and queues it for geocoding in the background.
+func CreateJob(ctx context.Context, input *CreateJobInput) (*JobOutput, error) {
+	file := input.RawBody.Data().File
+	defer file.Close()
+
+	mapping := jobs.Mapping{
+		Query:       input.QueryColumn,
+		Street:      input.StreetColumn,
+		HouseNumber: input.HouseNumberColumn,
+		Postcode:    input.PostcodeColumn,
+		City:        input.CityColumn,
+	}
+	job, err := jobs.Create(file, file.Filename, mapping, delimiters[input.Delimiter])
+	var inputErr *jobs.InputError
+	switch {
+	case errors.As(err, &inputErr):
+		return nil, huma.Error400BadRequest(err.Error())
+	case errors.Is(err, jobs.ErrQueueFull):
+		return nil, huma.Error503ServiceUnavailable(err.Error())
+	case err != nil:
+		return nil, fmt.Errorf("failed to create job: %w", err)
+	}
+
+	return &JobOutput{Body: *job}, nil
+}
@@ -0,0 +1,22 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/danielgtaylor/huma/v2"
+	"mnlr.de/addressserver/jobs"
+)
+
+// DeleteJob stops a geocoding job if it is still running and removes its files.
+func DeleteJob(ctx context.Context, input *JobInput) (*struct{}, error) {
+	err := jobs.Delete(input.ID)
+	if errors.Is(err, jobs.ErrNotFound) {
+		return nil, huma.Error404NotFound(err.Error())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete job: %w", err)
+	}
+	return nil, nil
+}
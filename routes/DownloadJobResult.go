@@ -0,0 +1,49 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/danielgtaylor/huma/v2"
+	"mnlr.de/addressserver/jobs"
+)
+
+// DownloadJobResult streams the enriched CSV file of a finished geocoding job.
+func DownloadJobResult(ctx context.Context, input *JobInput) (*huma.StreamResponse, error) {
+	job, err := jobs.Get(input.ID)
+	if errors.Is(err, jobs.ErrNotFound) {
+		return nil, huma.Error404NotFound(err.Error())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+	path, err := jobs.ResultPath(input.ID)
+	if errors.Is(err, jobs.ErrNotDone) {
+		return nil, huma.Error409Conflict(fmt.Sprintf("job is %s, the result is available once it is done", job.State))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job result: %w", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open job result: %w", err)
+	}
+
+	name := strings.TrimSuffix(job.Filename, ".csv")
+	if name == "" {
+		name = job.ID
+	}
+	return &huma.StreamResponse{
+		Body: func(ctx huma.Context) {
+			defer f.Close()
+			ctx.SetHeader("Content-Type", "text/csv; charset=utf-8")
+			ctx.SetHeader("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+"-geocoded.csv"))
+			io.Copy(ctx.BodyWriter(), f)
+		},
+	}, nil
+}
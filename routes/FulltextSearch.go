@@ -2,39 +2,272 @@ package routes
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 
+	"github.com/danielgtaylor/huma/v2"
+	"mnlr.de/addressserver/parse"
 	"mnlr.de/addressserver/sql"
 )
 
 // FulltextSearchInput represents the input for fulltext search.
 type FulltextSearchInput struct {
-	Query string `query:"q" example:"main street" doc:"The search query"`
+	Query          string `query:"q" example:"main street" doc:"The search query, supports \"phrases\", field:word, -excluded words and OR"`
+	Limit          int    `query:"limit" default:"100" minimum:"1" maximum:"1000" doc:"Maximum number of results per page"`
+	Cursor         string `query:"cursor" doc:"Token from the next field of a previous response to fetch the following page"`
+	Highlight      bool   `query:"highlight" doc:"Return the matched tokens of street, house number and city highlighted"`
+	HighlightStart string `query:"highlight_start" default:"<b>" maxLength:"16" doc:"Marker inserted before each highlighted token"`
+	HighlightEnd   string `query:"highlight_end" default:"</b>" maxLength:"16" doc:"Marker inserted after each highlighted token"`
+	Fuzzy          bool   `query:"fuzzy" doc:"Tolerate misspelled words, results are ordered by their fuzziness and not paginated"`
+
+	FocusLatitude  OptionalParam[float64] `query:"focus.lat" example:"49.4521" doc:"Latitude of a point to prefer nearby addresses, requires focus.lon"`
+	FocusLongitude OptionalParam[float64] `query:"focus.lon" example:"11.0767" doc:"Longitude of a point to prefer nearby addresses, requires focus.lat"`
+	FocusWeight    float64                `query:"focus.weight" default:"1" minimum:"0" maximum:"10" doc:"How strongly the distance to the focus point influences the ranking"`
+
+	City     string  `query:"city" example:"Nürnberg" doc:"Only return addresses in this city"`
+	Postcode string  `query:"postcode" example:"904" pattern:"^[0-9]{1,5}$" doc:"Only return addresses whose postcode starts with these digits, requires a database with postcodes"`
+	BBox     string  `query:"bbox" example:"11.03,49.42,11.12,49.48" doc:"Only return addresses inside this box, given as minLon,minLat,maxLon,maxLat"`
+	Near     string  `query:"near" example:"49.4521,11.0767" doc:"Only return addresses within radius of this point, given as lat,lon"`
+	RadiusKm float64 `query:"radius" default:"1.0" minimum:"0.01" maximum:"100" doc:"Radius around near in kilometers"`
+}
+
+// SearchResult represents a single address returned by the search.
+type SearchResult struct {
+	sql.Address
+	StreetMatch      string   `json:"street_match,omitempty" doc:"Street with highlighted matches, only set when highlight=true"`
+	HouseNumberMatch string   `json:"house_number_match,omitempty" doc:"House number with highlighted matches, only set when highlight=true"`
+	CityMatch        string   `json:"city_match,omitempty" doc:"City with highlighted matches, only set when highlight=true"`
+	PostcodeMatch    string   `json:"postcode_match,omitempty" doc:"Postcode with highlighted matches, only set when highlight=true and the address has a postcode"`
+	Fuzziness        *int     `json:"fuzziness,omitempty" doc:"Number of character edits between the query and this address, only set when fuzzy=true"`
+	Distance         *float64 `json:"distance_m,omitempty" doc:"Distance to the focus point in meters, only set when a focus point is given"`
+	Interpolated     bool     `json:"interpolated,omitempty" doc:"Whether the house number is missing in the database and its position was estimated from the neighbouring numbers, the id is 0 then"`
+	AccuracyM        *float64 `json:"accuracy_m,omitempty" doc:"Estimated error of an interpolated position in meters"`
+	Confidence       float64  `json:"confidence" minimum:"0" maximum:"1" doc:"How well the address matches the query, from 0 to 1"`
+	MatchType        string   `json:"match_type" enum:"exact,house-number-mismatch,street-only,city-only,fuzzy,interpolated" doc:"Which parts of the query the address matches"`
 }
 
 // FulltextSearchOutput represents the fulltext search operation response.
 type FulltextSearchOutput struct {
 	Body struct {
-		Addresses []sql.Address `json:"addresses" doc:"Matching addresses"`
+		Addresses []SearchResult   `json:"addresses" doc:"Matching addresses"`
+		Parsed    parse.Components `json:"parsed" doc:"Components the query was split into, of the first alternative for queries with OR, for debugging"`
+		Next      string           `json:"next,omitempty" doc:"Cursor for the next page, absent on the last page"`
 	}
 }
 
 // FulltextSearch performs a fulltext search on the address database.
 func FulltextSearch(ctx context.Context, input *FulltextSearchInput) (*FulltextSearchOutput, error) {
-	if input.Query == "" {
-		return nil, fmt.Errorf("search query cannot be empty")
+	if strings.TrimSpace(input.Query) == "" {
+		return nil, huma.Error400BadRequest("search query cannot be empty")
 	}
 
-	// Replace commas with spaces in the query
-	input.Query = strings.ReplaceAll(input.Query, ",", " ")
+	// Split the query into its alternatives and these into their address
+	// components, so each of them is only matched against its own column
+	alternatives, err := parse.Query(input.Query)
+	if err != nil {
+		return nil, huma.Error400BadRequest("invalid query: " + err.Error())
+	}
+	parsed := alternatives[0].WithPhrases()
+	plain := len(alternatives) == 1 && alternatives[0].Plain()
 
-	addresses, err := sql.FulltextSearch(input.Query)
+	after, err := sql.DecodeCursor(input.Cursor)
+	if err != nil {
+		return nil, huma.Error400BadRequest(err.Error())
+	}
+
+	opts := sql.SearchOptions{
+		Limit:          input.Limit,
+		After:          after,
+		Highlight:      input.Highlight,
+		HighlightStart: input.HighlightStart,
+		HighlightEnd:   input.HighlightEnd,
+		FocusWeight:    input.FocusWeight,
+		City:           strings.TrimSpace(input.City),
+		Postcode:       input.Postcode,
+		RadiusKm:       input.RadiusKm,
+	}
+
+	if input.BBox != "" {
+		if opts.BBox, err = parseBBox(input.BBox); err != nil {
+			return nil, huma.Error400BadRequest(err.Error())
+		}
+	}
+	if input.Near != "" {
+		if opts.Near, err = parsePoint(input.Near); err != nil {
+			return nil, huma.Error400BadRequest("near: " + err.Error())
+		}
+		if err := checkFinite("radius", input.RadiusKm); err != nil {
+			return nil, huma.Error400BadRequest(err.Error())
+		}
+	}
+
+	if input.FocusLatitude.IsSet || input.FocusLongitude.IsSet {
+		if !input.FocusLatitude.IsSet || !input.FocusLongitude.IsSet {
+			return nil, huma.Error400BadRequest("focus.lat and focus.lon must be given together")
+		}
+		focus := sql.Point{Latitude: input.FocusLatitude.Value, Longitude: input.FocusLongitude.Value}
+		if err := checkCoordinate(focus.Latitude, focus.Longitude); err != nil {
+			return nil, huma.Error400BadRequest("focus: " + err.Error())
+		}
+		if err := checkFinite("focus.weight", input.FocusWeight); err != nil {
+			return nil, huma.Error400BadRequest(err.Error())
+		}
+		opts.Focus = &focus
+	}
+
+	if input.Fuzzy {
+		if after != nil {
+			return nil, huma.Error400BadRequest("cursor is not supported in fuzzy mode")
+		}
+		if !plain {
+			return nil, huma.Error400BadRequest("phrases, excluded words and OR are not supported in fuzzy mode")
+		}
+		return fuzzySearch(parsed, opts)
+	}
+
+	matches, next, err := searchAlternatives(alternatives, opts)
+	if err == nil && len(matches) == 0 {
+		// Match the words in front of the house number against all columns if
+		// they aren't only the street, like in "Nürnberg Hauptmarkt 1"
+		if retry := relaxed(alternatives); retry != nil {
+			var retryMatches []sql.HighlightedMatch
+			retryMatches, next, err = searchAlternatives(retry, opts)
+			if len(retryMatches) > 0 {
+				matches, alternatives, parsed = retryMatches, retry, retry[0].WithPhrases()
+			}
+		}
+	}
+	if errors.Is(err, sql.ErrNoPostcodes) {
+		return nil, huma.Error501NotImplemented(err.Error())
+	}
 	if err != nil {
 		return nil, fmt.Errorf("fulltext search failed: %w", err)
 	}
 
 	resp := &FulltextSearchOutput{}
-	resp.Body.Addresses = addresses
+	resp.Body.Parsed = parsed
+	for _, m := range matches {
+		resp.Body.Addresses = append(resp.Body.Addresses, newSearchResult(m, opts.Focus))
+	}
+
+	// Estimate the position of a house number that is missing on the street,
+	// unless the filters or operators would have to be applied to the estimates as well
+	if len(matches) == 0 && after == nil && plain && parsed.Street != "" && parsed.HouseNumber != "" &&
+		opts.City == "" && opts.Postcode == "" && opts.BBox == nil && opts.Near == nil {
+		resp.Body.Addresses, err = interpolate(parsed, false, input.Limit)
+		if err != nil {
+			return nil, fmt.Errorf("interpolation failed: %w", err)
+		}
+		if retry, ok := parsed.Relaxed(); ok && len(resp.Body.Addresses) == 0 {
+			resp.Body.Addresses, err = interpolate(retry, false, input.Limit)
+			if err != nil {
+				return nil, fmt.Errorf("interpolation failed: %w", err)
+			}
+			alternatives, parsed = []parse.Alternative{{Components: retry}}, retry
+			resp.Body.Parsed = parsed
+		}
+	}
+	for i := range resp.Body.Addresses {
+		rateAny(&resp.Body.Addresses[i], alternatives)
+	}
+	if next != nil {
+		resp.Body.Next = next.Encode()
+	}
 	return resp, nil
 }
+
+// searchAlternatives finds the addresses matching any of the alternatives
+func searchAlternatives(alternatives []parse.Alternative, opts sql.SearchOptions) ([]sql.HighlightedMatch, *sql.Cursor, error) {
+	queries := make([]sql.ColumnQuery, len(alternatives))
+	for i, alt := range alternatives {
+		queries[i] = columnQuery(alt)
+	}
+	return sql.ColumnSearchAny(queries, opts)
+}
+
+// relaxed returns the alternatives with the words in front of the house number
+// unrestricted, see parse.Components.Relaxed. It returns nil if none of the
+// alternatives has such words.
+func relaxed(alternatives []parse.Alternative) []parse.Alternative {
+	var changed bool
+	result := make([]parse.Alternative, len(alternatives))
+	for i, alt := range alternatives {
+		result[i] = alt
+		if c, ok := alt.Components.Relaxed(); ok {
+			result[i].Components = c
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return result
+}
+
+// componentsQuery converts address components into a fulltext query
+func componentsQuery(c parse.Components) sql.ColumnQuery {
+	return sql.ColumnQuery{
+		Street:       c.Street,
+		HouseNumbers: c.HouseNumbers(),
+		Postcode:     c.Postcode,
+		City:         c.City,
+		Text:         c.Rest,
+	}
+}
+
+// columnQuery converts an alternative of the query into a fulltext query
+func columnQuery(alt parse.Alternative) sql.ColumnQuery {
+	q := componentsQuery(alt.Components)
+	for _, p := range alt.Phrases {
+		q.Phrases = append(q.Phrases, sql.Phrase{Column: p.Field, Text: p.Text})
+	}
+	for _, p := range alt.Excluded {
+		q.Excluded = append(q.Excluded, sql.Phrase{Column: p.Field, Text: p.Text})
+	}
+	return q
+}
+
+// fuzzySearch performs the typo tolerant variant of the fulltext search. The
+// words are matched against all columns, the postcode is left out if the
+// database has no postcodes.
+func fuzzySearch(parsed parse.Components, opts sql.SearchOptions) (*FulltextSearchOutput, error) {
+	words := []string{parsed.Street, parsed.HouseNumber, parsed.City, parsed.Rest}
+	if sql.HasPostcodes() {
+		words = append(words, parsed.Postcode)
+	}
+	matches, err := sql.FuzzySearch(strings.Join(words, " "), opts)
+	if errors.Is(err, sql.ErrNoPostcodes) {
+		return nil, huma.Error501NotImplemented(err.Error())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("fuzzy search failed: %w", err)
+	}
+
+	resp := &FulltextSearchOutput{}
+	resp.Body.Parsed = parsed
+	for _, m := range matches {
+		result := newSearchResult(m.HighlightedMatch, opts.Focus)
+		result.Fuzziness = &m.Fuzziness
+		rate(&result, parsed)
+		resp.Body.Addresses = append(resp.Body.Addresses, result)
+	}
+	return resp, nil
+}
+
+// newSearchResult converts a search match into its response representation,
+// including the distance to the focus point if there is one.
+func newSearchResult(m sql.HighlightedMatch, focus *sql.Point) SearchResult {
+	result := SearchResult{
+		Address:          m.Address,
+		StreetMatch:      m.StreetMatch,
+		HouseNumberMatch: m.HouseNumberMatch,
+		CityMatch:        m.CityMatch,
+		PostcodeMatch:    m.PostcodeMatch,
+	}
+	if focus != nil {
+		distance := sql.CalculateDistance(focus.Latitude, focus.Longitude, m.Address.Latitude, m.Address.Longitude) * 1000
+		result.Distance = &distance
+	}
+	return result
+}
@@ -0,0 +1,32 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/danielgtaylor/huma/v2"
+	"mnlr.de/addressserver/sql"
+)
+
+// GetAddressInput represents the input for an address lookup by ID.
+type GetAddressInput struct {
+	ID int64 `path:"id" example:"18800" minimum:"1" doc:"ID of the address as returned by the other endpoints"`
+}
+
+// GetAddressOutput represents the address lookup response.
+type GetAddressOutput struct {
+	Body sql.Address
+}
+
+// GetAddress returns the address with the given ID.
+func GetAddress(ctx context.Context, input *GetAddressInput) (*GetAddressOutput, error) {
+	addr, err := sql.GetAddressById(input.ID)
+	if err != nil {
+		return nil, fmt.Errorf("address lookup failed: %w", err)
+	}
+	if addr == nil {
+		return nil, huma.Error404NotFound(fmt.Sprintf("address %d not found", input.ID))
+	}
+
+	return &GetAddressOutput{Body: *addr}, nil
+}
@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/danielgtaylor/huma/v2"
+	"mnlr.de/addressserver/jobs"
+)
+
+// JobInput identifies a geocoding job.
+type JobInput struct {
+	ID string `path:"id" example:"3f2a9c0d41b7e865" pattern:"^[0-9a-f]{16}$" doc:"Job ID returned when the file was uploaded"`
+}
+
+// GetJob returns the state and progress of a geocoding job.
+func GetJob(ctx context.Context, input *JobInput) (*JobOutput, error) {
+	job, err := jobs.Get(input.ID)
+	if errors.Is(err, jobs.ErrNotFound) {
+		return nil, huma.Error404NotFound(err.Error())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+	return &JobOutput{Body: *job}, nil
+}
@@ -0,0 +1,36 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/danielgtaylor/huma/v2"
+	"mnlr.de/addressserver/sql"
+)
+
+// GetPostcodeInput represents the input for a postcode lookup.
+type GetPostcodeInput struct {
+	Postcode string `path:"postcode" example:"90403" pattern:"^[0-9]{5}$" doc:"The postcode to look up"`
+}
+
+// GetPostcodeOutput represents the postcode lookup response.
+type GetPostcodeOutput struct {
+	Body sql.PostcodeDetail
+}
+
+// GetPostcode returns the cities, address count and area of a postcode.
+func GetPostcode(ctx context.Context, input *GetPostcodeInput) (*GetPostcodeOutput, error) {
+	detail, err := sql.GetPostcode(input.Postcode)
+	if errors.Is(err, sql.ErrNoPostcodes) {
+		return nil, huma.Error501NotImplemented(err.Error())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("postcode lookup failed: %w", err)
+	}
+	if detail == nil {
+		return nil, huma.Error404NotFound("postcode " + input.Postcode + " not found")
+	}
+
+	return &GetPostcodeOutput{Body: *detail}, nil
+}
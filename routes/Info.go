@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+
+	"mnlr.de/addressserver/sql"
+)
+
+// InfoOutput represents the database info response.
+type InfoOutput struct {
+	Body sql.Info
+}
+
+// Info returns statistics and metadata of the loaded database.
+func Info(ctx context.Context, input *struct{}) (*InfoOutput, error) {
+	info, err := sql.GetInfo()
+	if err != nil {
+		return nil, fmt.Errorf("database info failed: %w", err)
+	}
+
+	return &InfoOutput{Body: *info}, nil
+}
@@ -0,0 +1,37 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+
+	"mnlr.de/addressserver/sql"
+)
+
+// ListCitiesInput represents the input for listing cities.
+type ListCitiesInput struct {
+	Prefix string `query:"prefix" example:"Nür" doc:"Only list cities starting with this text (case-sensitive)"`
+	Sort   string `query:"sort" default:"name" enum:"name,count" doc:"Order of the cities: alphabetically by name or by address count, most first"`
+	Page   int    `query:"page" default:"1" minimum:"1" doc:"Page number, starting at 1"`
+	Limit  int    `query:"limit" default:"100" minimum:"1" maximum:"1000" doc:"Maximum number of cities per page"`
+}
+
+// ListCitiesOutput represents the city list response.
+type ListCitiesOutput struct {
+	Body struct {
+		Cities []sql.CitySummary `json:"cities" doc:"Cities with their number of addresses"`
+		Total  int64             `json:"total" doc:"Number of cities matching the prefix"`
+	}
+}
+
+// ListCities lists the cities of the database with their address counts.
+func ListCities(ctx context.Context, input *ListCitiesInput) (*ListCitiesOutput, error) {
+	cities, total, err := sql.GetCitySummary(input.Prefix, input.Sort, input.Page, input.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("list cities failed: %w", err)
+	}
+
+	resp := &ListCitiesOutput{}
+	resp.Body.Cities = cities
+	resp.Body.Total = total
+	return resp, nil
+}
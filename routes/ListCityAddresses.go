@@ -0,0 +1,40 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/danielgtaylor/huma/v2"
+	"mnlr.de/addressserver/sql"
+)
+
+// ListCityAddressesInput represents the input for listing the addresses of a city.
+type ListCityAddressesInput struct {
+	City  string `path:"city" example:"Nürnberg" doc:"Name of the city exactly as listed by /cities"`
+	Page  int    `query:"page" default:"1" minimum:"1" doc:"Page number, starting at 1"`
+	Limit int    `query:"limit" default:"100" minimum:"1" maximum:"1000" doc:"Maximum number of addresses per page"`
+}
+
+// ListCityAddressesOutput represents the city addresses response.
+type ListCityAddressesOutput struct {
+	Body struct {
+		Addresses []sql.Address `json:"addresses" doc:"Addresses of the city in stable order"`
+		Total     int64         `json:"total" doc:"Number of addresses of the city"`
+	}
+}
+
+// ListCityAddresses lists the addresses of a city page by page.
+func ListCityAddresses(ctx context.Context, input *ListCityAddressesInput) (*ListCityAddressesOutput, error) {
+	addresses, total, err := sql.GetAddressesByCity(input.City, input.Page, input.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("list city addresses failed: %w", err)
+	}
+	if total == 0 {
+		return nil, huma.Error404NotFound("city " + input.City + " not found")
+	}
+
+	resp := &ListCityAddressesOutput{}
+	resp.Body.Addresses = addresses
+	resp.Body.Total = total
+	return resp, nil
+}
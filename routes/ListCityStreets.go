@@ -0,0 +1,47 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/danielgtaylor/huma/v2"
+	"mnlr.de/addressserver/sql"
+)
+
+// ListCityStreetsInput represents the input for listing the streets of a city.
+type ListCityStreetsInput struct {
+	City   string `path:"city" example:"Nürnberg" doc:"Name of the city exactly as listed by /cities"`
+	Prefix string `query:"prefix" example:"Haupt" doc:"Only list streets starting with this text (case-sensitive)"`
+	Page   int    `query:"page" default:"1" minimum:"1" doc:"Page number, starting at 1"`
+	Limit  int    `query:"limit" default:"100" minimum:"1" maximum:"1000" doc:"Maximum number of streets per page"`
+}
+
+// ListCityStreetsOutput represents the city streets response.
+type ListCityStreetsOutput struct {
+	Body struct {
+		Streets []sql.StreetSummary `json:"streets" doc:"Streets in alphabetical order with their address count and area"`
+		Total   int64               `json:"total" doc:"Number of streets matching the prefix"`
+	}
+}
+
+// ListCityStreets lists the streets of a city with their address counts and areas.
+func ListCityStreets(ctx context.Context, input *ListCityStreetsInput) (*ListCityStreetsOutput, error) {
+	streets, total, err := sql.GetStreetsByCity(input.City, input.Prefix, input.Page, input.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("list city streets failed: %w", err)
+	}
+	if total == 0 {
+		exists, err := sql.CityExists(input.City)
+		if err != nil {
+			return nil, fmt.Errorf("list city streets failed: %w", err)
+		}
+		if !exists {
+			return nil, huma.Error404NotFound("city " + input.City + " not found")
+		}
+	}
+
+	resp := &ListCityStreetsOutput{}
+	resp.Body.Streets = streets
+	resp.Body.Total = total
+	return resp, nil
+}
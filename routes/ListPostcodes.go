@@ -0,0 +1,41 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/danielgtaylor/huma/v2"
+	"mnlr.de/addressserver/sql"
+)
+
+// ListPostcodesInput represents the input for listing postcodes.
+type ListPostcodesInput struct {
+	Prefix string `query:"prefix" example:"904" pattern:"^[0-9]{0,5}$" doc:"Only list postcodes starting with these digits"`
+	After  string `query:"after" doc:"Postcode from the next field of a previous response to fetch the following page"`
+	Limit  int    `query:"limit" default:"100" minimum:"1" maximum:"1000" doc:"Maximum number of postcodes per page"`
+}
+
+// ListPostcodesOutput represents the postcode list response.
+type ListPostcodesOutput struct {
+	Body struct {
+		Postcodes []sql.PostcodeSummary `json:"postcodes" doc:"Postcodes in ascending order with the cities they cover"`
+		Next      string                `json:"next,omitempty" doc:"Value for after to fetch the next page, absent on the last page"`
+	}
+}
+
+// ListPostcodes lists the postcodes of the database with their cities and address counts.
+func ListPostcodes(ctx context.Context, input *ListPostcodesInput) (*ListPostcodesOutput, error) {
+	postcodes, next, err := sql.ListPostcodes(input.Prefix, input.After, input.Limit)
+	if errors.Is(err, sql.ErrNoPostcodes) {
+		return nil, huma.Error501NotImplemented(err.Error())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list postcodes failed: %w", err)
+	}
+
+	resp := &ListPostcodesOutput{}
+	resp.Body.Postcodes = postcodes
+	resp.Body.Next = next
+	return resp, nil
+}
@@ -0,0 +1,37 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/danielgtaylor/huma/v2"
+	"mnlr.de/addressserver/sql"
+)
+
+// ListStreetNumbersInput represents the input for listing the house numbers of a street.
+type ListStreetNumbersInput struct {
+	City   string `path:"city" example:"Nürnberg" doc:"Name of the city exactly as listed by /cities"`
+	Street string `path:"street" example:"Hauptmarkt" doc:"Name of the street exactly as listed by /cities/{city}/streets"`
+}
+
+// ListStreetNumbersOutput represents the house numbers response.
+type ListStreetNumbersOutput struct {
+	Body struct {
+		Numbers []sql.StreetNumber `json:"numbers" doc:"House numbers in natural order, e.g. 2, 2a, 10"`
+	}
+}
+
+// ListStreetNumbers lists the house numbers of a street in natural order.
+func ListStreetNumbers(ctx context.Context, input *ListStreetNumbersInput) (*ListStreetNumbersOutput, error) {
+	numbers, err := sql.GetStreetNumbers(input.City, input.Street)
+	if err != nil {
+		return nil, fmt.Errorf("list street numbers failed: %w", err)
+	}
+	if len(numbers) == 0 {
+		return nil, huma.Error404NotFound("street " + input.Street + " not found in " + input.City)
+	}
+
+	resp := &ListStreetNumbersOutput{}
+	resp.Body.Numbers = numbers
+	return resp, nil
+}
@@ -0,0 +1,62 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/danielgtaylor/huma/v2"
+	"mnlr.de/addressserver/sql"
+)
+
+// NearbyAddressesInput represents the input for the neighbours of an address.
+type NearbyAddressesInput struct {
+	ID       int64   `path:"id" example:"18800" minimum:"1" doc:"ID of the address whose neighbours are returned"`
+	RadiusKm float64 `query:"radius" default:"0.5" minimum:"0.01" maximum:"10.0" doc:"Search radius in kilometers"`
+	Limit    int     `query:"limit" default:"10" minimum:"1" maximum:"100" doc:"Maximum number of results per page"`
+	Cursor   string  `query:"cursor" doc:"Token from the next field of a previous response to fetch the following page"`
+}
+
+// NearbyAddress represents a neighbour of an address.
+type NearbyAddress struct {
+	sql.Address
+	Distance float64 `json:"distance_m" doc:"Distance to the address in meters"`
+}
+
+// NearbyAddressesOutput represents the nearby addresses response.
+type NearbyAddressesOutput struct {
+	Body struct {
+		Address   sql.Address     `json:"address" doc:"The address with the requested ID"`
+		Addresses []NearbyAddress `json:"addresses" doc:"Neighbouring addresses, closest first"`
+		Next      string          `json:"next,omitempty" doc:"Cursor for the next page, absent on the last page"`
+	}
+}
+
+// NearbyAddresses returns the addresses around the address with the given ID.
+func NearbyAddresses(ctx context.Context, input *NearbyAddressesInput) (*NearbyAddressesOutput, error) {
+	if err := checkFinite("radius", input.RadiusKm); err != nil {
+		return nil, huma.Error400BadRequest(err.Error())
+	}
+	after, err := sql.DecodeCursor(input.Cursor)
+	if err != nil {
+		return nil, huma.Error400BadRequest(err.Error())
+	}
+
+	origin, addresses, distances, next, err := sql.FindNearbyAddresses(input.ID, input.RadiusKm, after, input.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("nearby search failed: %w", err)
+	}
+	if origin == nil {
+		return nil, huma.Error404NotFound(fmt.Sprintf("address %d not found", input.ID))
+	}
+
+	resp := &NearbyAddressesOutput{}
+	resp.Body.Address = *origin
+	resp.Body.Addresses = make([]NearbyAddress, len(addresses))
+	for i, addr := range addresses {
+		resp.Body.Addresses[i] = NearbyAddress{Address: addr, Distance: distances[i] * 1000}
+	}
+	if next != nil {
+		resp.Body.Next = next.Encode()
+	}
+	return resp, nil
+}
@@ -3,33 +3,50 @@ package routes
 import (
 	"context"
 	"fmt"
+	"sort"
 
+	"github.com/danielgtaylor/huma/v2"
 	"mnlr.de/addressserver/sql"
 )
 
 // ReverseGeocodeInput represents the input for reverse geocoding.
 type ReverseGeocodeInput struct {
-	Latitude  float64 `query:"lat" example:"49.4521" doc:"Latitude coordinate"`
-	Longitude float64 `query:"lon" example:"11.0767" doc:"Longitude coordinate"`
-	RadiusKm  float64 `query:"radius" default:"1.0" min:"0.01" max:"10.0" doc:"Search radius in kilometers"`
-	Limit     int     `query:"limit" default:"10" min:"1" max:"100" doc:"Maximum number of results to return"`
+	Latitude  float64 `query:"lat" example:"49.4521" doc:"Latitude coordinate, between -90 and 90"`
+	Longitude float64 `query:"lon" example:"11.0767" doc:"Longitude coordinate, between -180 and 180"`
+	RadiusKm  float64 `query:"radius" default:"1.0" minimum:"0.01" maximum:"10.0" doc:"Search radius in kilometers"`
+	Limit     int     `query:"limit" default:"10" minimum:"1" maximum:"100" doc:"Maximum number of results per page"`
+	Cursor    string  `query:"cursor" doc:"Token from the next field of a previous response to fetch the following page"`
+	Sort      string  `query:"sort" default:"distance" enum:"distance,house_number" doc:"Order of the addresses of a page: nearest first, or by street and house number. Pages always hold the nearest addresses."`
+
+	Mode          string  `query:"mode" default:"radius" enum:"radius,nearest" doc:"radius returns the addresses within radius page by page, nearest the k nearest addresses however far away they are"`
+	K             int     `query:"k" default:"5" minimum:"1" maximum:"100" doc:"Number of addresses in nearest mode"`
+	MaxDistanceKm float64 `query:"max_distance" minimum:"0" doc:"Maximum distance in kilometers in nearest mode, 0 for unlimited"`
+}
+
+// ReverseResult represents a single address returned by reverse geocoding.
+type ReverseResult struct {
+	sql.Address
+	Distance   float64 `json:"distance_m" doc:"Distance from the coordinates in meters"`
+	Bearing    float64 `json:"bearing" minimum:"0" maximum:"360" doc:"Compass direction from the coordinates to the address in degrees, 0 is north and 90 east"`
+	Confidence float64 `json:"confidence" minimum:"0" maximum:"1" doc:"How likely the address is the one at the coordinates, from 1 at the exact position down to 0.5 at 50 m"`
+	MatchType  string  `json:"match_type" enum:"exact" doc:"Always exact, the addresses exist in the database"`
 }
 
 // ReverseGeocodeOutput represents the reverse geocode operation response.
 type ReverseGeocodeOutput struct {
 	Body struct {
-		Addresses []sql.Address `json:"addresses" doc:"Addresses found near the coordinates"`
+		Addresses []ReverseResult `json:"addresses" doc:"Addresses found near the coordinates"`
+		Next      string          `json:"next,omitempty" doc:"Cursor for the next page, absent on the last page"`
 	}
 }
 
 // ReverseGeocode takes coordinates and returns addresses near that location.
 func ReverseGeocode(ctx context.Context, input *ReverseGeocodeInput) (*ReverseGeocodeOutput, error) {
-	// Input validation
-	if input.Latitude < -90 || input.Latitude > 90 {
-		return nil, fmt.Errorf("latitude must be between -90 and 90")
+	if err := checkCoordinate(input.Latitude, input.Longitude); err != nil {
+		return nil, huma.Error400BadRequest(err.Error())
 	}
-	if input.Longitude < -180 || input.Longitude > 180 {
-		return nil, fmt.Errorf("longitude must be between -180 and 180")
+	if err := checkFinite("radius", input.RadiusKm); err != nil {
+		return nil, huma.Error400BadRequest(err.Error())
 	}
 
 	// Use default values if not specified
@@ -38,19 +55,73 @@ func ReverseGeocode(ctx context.Context, input *ReverseGeocodeInput) (*ReverseGe
 		radiusKm = 1.0
 	}
 
-	// Find addresses in the specified radius
-	addresses, err := sql.FindAddressesInRadius(input.Latitude, input.Longitude, radiusKm)
+	if input.Mode == "nearest" {
+		if input.Cursor != "" {
+			return nil, huma.Error400BadRequest("cursor is not supported in nearest mode")
+		}
+		if err := checkFinite("max_distance", input.MaxDistanceKm); err != nil {
+			return nil, huma.Error400BadRequest(err.Error())
+		}
+		addresses, distances, err := sql.FindNearestAddresses(input.Latitude, input.Longitude, input.K, input.MaxDistanceKm)
+		if err != nil {
+			return nil, fmt.Errorf("reverse geocoding failed: %w", err)
+		}
+		resp := &ReverseGeocodeOutput{}
+		resp.Body.Addresses = newReverseResults(addresses, distances, input.Latitude, input.Longitude, input.Sort)
+		return resp, nil
+	}
+
+	after, err := sql.DecodeCursor(input.Cursor)
 	if err != nil {
-		return nil, fmt.Errorf("reverse geocoding failed: %w", err)
+		return nil, huma.Error400BadRequest(err.Error())
 	}
 
-	// Apply limit if provided
-	if input.Limit > 0 && input.Limit < len(addresses) {
-		addresses = addresses[:input.Limit]
+	// Find addresses in the specified radius
+	addresses, distances, next, err := sql.FindAddressesInRadius(input.Latitude, input.Longitude, radiusKm, after, input.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("reverse geocoding failed: %w", err)
 	}
 
 	// Return results
 	resp := &ReverseGeocodeOutput{}
-	resp.Body.Addresses = addresses
+	resp.Body.Addresses = newReverseResults(addresses, distances, input.Latitude, input.Longitude, input.Sort)
+	if next != nil {
+		resp.Body.Next = next.Encode()
+	}
 	return resp, nil
 }
+
+// newReverseResults rates the addresses found near a point, given nearest
+// first with their distances in km. With sortBy house_number they are
+// reordered by street, the street with the nearest address first, and by
+// house number within each street.
+func newReverseResults(addresses []sql.Address, distances []float64, latitude, longitude float64, sortBy string) []ReverseResult {
+	results := make([]ReverseResult, len(addresses))
+	for i, addr := range addresses {
+		results[i] = ReverseResult{
+			Address:  addr,
+			Distance: distances[i] * 1000,
+			Bearing:  sql.CalculateBearing(latitude, longitude, addr.Latitude, addr.Longitude),
+		}
+		rateReverse(&results[i])
+	}
+
+	if sortBy == "house_number" {
+		// Rank of each street by its nearest address
+		type street struct{ name, city string }
+		rank := make(map[street]int)
+		for _, r := range results {
+			if _, ok := rank[street{r.Street, r.City}]; !ok {
+				rank[street{r.Street, r.City}] = len(rank)
+			}
+		}
+		sort.SliceStable(results, func(i, j int) bool {
+			ri, rj := rank[street{results[i].Street, results[i].City}], rank[street{results[j].Street, results[j].City}]
+			if ri != rj {
+				return ri < rj
+			}
+			return sql.HouseNumberLess(results[i].HouseNumber, results[j].HouseNumber)
+		})
+	}
+	return results
+}
@@ -0,0 +1,77 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/danielgtaylor/huma/v2"
+	"mnlr.de/addressserver/parse"
+	"mnlr.de/addressserver/sql"
+)
+
+// StructuredSearchInput represents the input for a structured address search.
+type StructuredSearchInput struct {
+	Street      string `query:"street" example:"Hauptmarkt" doc:"Street name"`
+	HouseNumber string `query:"house_number" example:"1" doc:"House number, always matched exactly"`
+	Postcode    string `query:"postcode" example:"90403" doc:"Postcode, always matched exactly, requires a database with postcodes"`
+	City        string `query:"city" example:"Nürnberg" doc:"City name"`
+	Match       string `query:"match" default:"prefix" enum:"prefix,exact" doc:"Whether street and city are matched by prefix or exactly"`
+	Limit       int    `query:"limit" default:"100" minimum:"1" maximum:"1000" doc:"Maximum number of results to return"`
+}
+
+// StructuredSearchOutput represents the structured search operation response.
+type StructuredSearchOutput struct {
+	Body struct {
+		Addresses []SearchResult `json:"addresses" doc:"Matching addresses, or the estimated position of a missing house number"`
+	}
+}
+
+// StructuredSearch searches addresses by their individual street, house number and city fields.
+func StructuredSearch(ctx context.Context, input *StructuredSearchInput) (*StructuredSearchOutput, error) {
+	query := sql.AddressQuery{
+		Street:      strings.TrimSpace(input.Street),
+		HouseNumber: strings.TrimSpace(input.HouseNumber),
+		Postcode:    strings.TrimSpace(input.Postcode),
+		City:        strings.TrimSpace(input.City),
+		Exact:       input.Match == "exact",
+		Limit:       input.Limit,
+	}
+	if query.Street == "" && query.HouseNumber == "" && query.Postcode == "" && query.City == "" {
+		return nil, huma.Error400BadRequest("at least one of street, house_number, postcode or city must be set")
+	}
+
+	addresses, err := sql.SearchByAddress(query)
+	if errors.Is(err, sql.ErrNoPostcodes) {
+		return nil, huma.Error501NotImplemented(err.Error())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("structured search failed: %w", err)
+	}
+
+	resp := &StructuredSearchOutput{}
+	for _, addr := range addresses {
+		resp.Body.Addresses = append(resp.Body.Addresses, SearchResult{Address: addr})
+	}
+
+	parsed := parse.Components{
+		Street:      query.Street,
+		HouseNumber: strings.ToLower(query.HouseNumber),
+		Postcode:    query.Postcode,
+		City:        query.City,
+	}
+
+	// Estimate the position of a house number that is missing on the street
+	if len(addresses) == 0 && query.Street != "" && query.HouseNumber != "" {
+		resp.Body.Addresses, err = interpolate(parsed, query.Exact, query.Limit)
+		if err != nil {
+			return nil, fmt.Errorf("interpolation failed: %w", err)
+		}
+	}
+
+	for i := range resp.Body.Addresses {
+		rate(&resp.Body.Addresses[i], parsed)
+	}
+	return resp, nil
+}
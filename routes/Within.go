@@ -0,0 +1,48 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/danielgtaylor/huma/v2"
+	"mnlr.de/addressserver/sql"
+)
+
+// WithinInput represents the input for the addresses inside an area.
+type WithinInput struct {
+	Limit  int    `query:"limit" default:"1000" minimum:"1" maximum:"10000" doc:"Maximum number of results per page"`
+	Cursor string `query:"cursor" doc:"Token from the next field of a previous response to fetch the following page"`
+	Body   GeoJSONGeometry
+}
+
+// WithinOutput represents the addresses inside an area.
+type WithinOutput struct {
+	Body struct {
+		Addresses []sql.Address `json:"addresses" doc:"Addresses inside the area, ordered by ID"`
+		Next      string        `json:"next,omitempty" doc:"Cursor for the next page, absent on the last page"`
+	}
+}
+
+// Within returns the addresses inside a GeoJSON Polygon or MultiPolygon.
+func Within(ctx context.Context, input *WithinInput) (*WithinOutput, error) {
+	area, err := input.Body.area()
+	if err != nil {
+		return nil, huma.Error400BadRequest(err.Error())
+	}
+	after, err := sql.DecodeCursor(input.Cursor)
+	if err != nil {
+		return nil, huma.Error400BadRequest(err.Error())
+	}
+
+	addresses, next, err := sql.FindAddressesWithin(area, after, input.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("area search failed: %w", err)
+	}
+
+	resp := &WithinOutput{}
+	resp.Body.Addresses = addresses
+	if next != nil {
+		resp.Body.Next = next.Encode()
+	}
+	return resp, nil
+}
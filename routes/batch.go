@@ -0,0 +1,35 @@
+package routes
+
+import (
+	"context"
+	"sync"
+)
+
+// batchConcurrency is the number of batch items processed at the same time.
+// SQLite serves the reads of the WAL database in parallel, more workers
+// than this mostly compete for the same disk pages.
+const batchConcurrency = 8
+
+// runBatch calls process for every item index in [0, n) with at most
+// batchConcurrency calls running at the same time and returns when all of
+// them are done. Once ctx is cancelled the remaining items are passed to
+// skip with the context error instead.
+func runBatch(ctx context.Context, n int, process func(i int), skip func(i int, err error)) {
+	sem := make(chan struct{}, batchConcurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			skip(i, ctx.Err())
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			process(i)
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,235 @@
+package routes
+
+import (
+	"math"
+	"strings"
+	"unicode"
+
+	"mnlr.de/addressserver/normalize"
+	"mnlr.de/addressserver/parse"
+	"mnlr.de/addressserver/sql"
+)
+
+// Weights of the address components in the confidence of a match. Words the
+// parser could not assign are weighted like a city.
+const (
+	streetWeight      = 0.4
+	houseNumberWeight = 0.3
+	cityWeight        = 0.2
+	postcodeWeight    = 0.1
+)
+
+// Match types of a result, telling which parts of the query it matches
+const (
+	matchExact               = "exact"                 // Street and house number, or the address at the coordinates
+	matchHouseNumberMismatch = "house-number-mismatch" // The street, but another house number
+	matchStreetOnly          = "street-only"           // The street, the query has no house number
+	matchCityOnly            = "city-only"             // Only the city or postcode
+	matchFuzzy               = "fuzzy"                 // Misspelled words
+	matchInterpolated        = "interpolated"          // Estimated position of a missing house number
+)
+
+// Upper bounds of the confidence of results that match only part of an
+// address, so they stay below the exact matches even for queries that consist
+// of a street or city only. They are the weights the match type can reach.
+const (
+	streetOnlyConfidence = 1 - houseNumberWeight
+	cityOnlyConfidence   = cityWeight + postcodeWeight
+)
+
+const (
+	// fuzzinessPenalty is the confidence lost per character edit of a fuzzy match
+	fuzzinessPenalty = 0.15
+	// halfConfidenceM is the distance at which the confidence of a reverse
+	// result or the accuracy of an interpolation halves the confidence
+	halfConfidenceM = 50.0
+)
+
+// rateAny rates a result of a query with several alternatives by the
+// alternative it matches best
+func rateAny(result *SearchResult, alternatives []parse.Alternative) {
+	best := *result
+	for i, alt := range alternatives {
+		candidate := *result
+		rate(&candidate, alt.WithPhrases())
+		if i == 0 || candidate.Confidence > best.Confidence {
+			best = candidate
+		}
+	}
+	*result = best
+}
+
+// rate sets the confidence and match type of a search result for the query components
+func rate(result *SearchResult, parsed parse.Components) {
+	result.Confidence = confidence(parsed, result.Address)
+	switch {
+	case result.Interpolated:
+		result.MatchType = matchInterpolated
+		result.Confidence *= distanceFactor(*result.AccuracyM)
+	case result.Fuzziness != nil && *result.Fuzziness > 0:
+		// The misspelled words don't compare equal, so only the fuzziness and
+		// the house number, which is never corrected, count
+		result.MatchType = matchFuzzy
+		result.Confidence = math.Max(0, 1-fuzzinessPenalty*float64(*result.Fuzziness))
+		if parsed.HouseNumber != "" && !matchesHouseNumber(parsed, result.Address) {
+			result.Confidence *= 1 - houseNumberWeight
+		}
+	default:
+		result.MatchType = matchType(parsed, result.Address)
+		switch result.MatchType {
+		case matchStreetOnly:
+			result.Confidence *= streetOnlyConfidence
+		case matchCityOnly:
+			result.Confidence *= cityOnlyConfidence
+		}
+	}
+	result.Confidence = math.Round(result.Confidence*100) / 100
+}
+
+// rateReverse sets the confidence of a reverse geocoding result, which
+// decreases with the distance of the address to the requested point
+func rateReverse(result *ReverseResult) {
+	result.MatchType = matchExact
+	result.Confidence = math.Round(distanceFactor(result.Distance)*100) / 100
+}
+
+// distanceFactor is 1 for a distance of 0 and halves at halfConfidenceM
+func distanceFactor(distanceM float64) float64 {
+	return 1 / (1 + distanceM/halfConfidenceM)
+}
+
+// matchType tells which components of the query the address matches. Words
+// the parser could not assign count for the street if they match it better
+// than the city.
+func matchType(parsed parse.Components, addr sql.Address) string {
+	street := parsed.Street != "" && textScore(parsed.Street, addr.Street) > 0
+	streetTokens := words(addr.Street)
+	cityTokens := words(addr.City)
+	for _, word := range words(parsed.Rest) {
+		if wordScore(word, streetTokens) > wordScore(word, cityTokens) {
+			street = true
+		}
+	}
+	houseNumber := parsed.HouseNumber != "" && matchesHouseNumber(parsed, addr)
+
+	switch {
+	case street && houseNumber:
+		return matchExact
+	case street && parsed.HouseNumber != "":
+		return matchHouseNumberMismatch
+	case street:
+		return matchStreetOnly
+	default:
+		return matchCityOnly
+	}
+}
+
+// matchesHouseNumber reports whether the address has one of the queried house numbers
+func matchesHouseNumber(parsed parse.Components, addr sql.Address) bool {
+	for _, number := range parsed.HouseNumbers() {
+		if strings.EqualFold(number, addr.HouseNumber) {
+			return true
+		}
+	}
+	return false
+}
+
+// confidence rates how well addr matches the query components from 0 to 1 as
+// the weighted share of the given components the address agrees with. Street
+// and city are compared in normalized form, a prefix of the address value
+// counts half. A postcode the address lacks is left out of the rating.
+func confidence(parsed parse.Components, addr sql.Address) float64 {
+	var total, matched float64
+	add := func(weight, score float64) {
+		total += weight
+		matched += weight * score
+	}
+
+	if parsed.Street != "" {
+		add(streetWeight, textScore(parsed.Street, addr.Street))
+	}
+	if parsed.HouseNumber != "" {
+		score := 0.0
+		if matchesHouseNumber(parsed, addr) {
+			score = 1
+		}
+		add(houseNumberWeight, score)
+	}
+	if parsed.Postcode != "" && addr.Postcode != "" {
+		score := 0.0
+		if parsed.Postcode == addr.Postcode {
+			score = 1
+		}
+		add(postcodeWeight, score)
+	}
+	if parsed.City != "" {
+		add(cityWeight, textScore(parsed.City, addr.City))
+	}
+	if parsed.Rest != "" {
+		add(cityWeight, wordsScore(parsed.Rest, addr.Street+" "+addr.HouseNumber+" "+addr.City))
+	}
+
+	if total == 0 {
+		return 0
+	}
+	return matched / total
+}
+
+// textScore compares a query value with an address value: 1 if they are equal
+// in normalized form, 0.5 if the query is a prefix of the address value
+func textScore(query, value string) float64 {
+	q, v := strings.Join(words(query), " "), strings.Join(words(value), " ")
+	switch {
+	case q == v:
+		return 1
+	case strings.HasPrefix(v, q):
+		return 0.5
+	default:
+		return 0
+	}
+}
+
+// wordsScore returns the share of the query words that are a word of text,
+// a word that is only the prefix of a word of text counts half
+func wordsScore(query, text string) float64 {
+	queryWords, tokens := words(query), words(text)
+	if len(queryWords) == 0 {
+		return 0
+	}
+
+	var score float64
+	for _, word := range queryWords {
+		score += wordScore(word, tokens)
+	}
+	return score / float64(len(queryWords))
+}
+
+// words returns the normalized words of text without the punctuation around
+// them, like "(Hauptmarkt)" or "Hauptmarkt*"
+func words(text string) []string {
+	var result []string
+	for _, word := range strings.Fields(normalize.Text(text)) {
+		word = strings.TrimFunc(word, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		if word != "" {
+			result = append(result, word)
+		}
+	}
+	return result
+}
+
+// wordScore returns 1 if the normalized word is one of the tokens, 0.5 if it
+// is the prefix of one and 0 otherwise
+func wordScore(word string, tokens []string) float64 {
+	best := 0.0
+	for _, token := range tokens {
+		if token == word {
+			return 1
+		}
+		if strings.HasPrefix(token, word) {
+			best = 0.5
+		}
+	}
+	return best
+}
@@ -0,0 +1,34 @@
+package routes
+
+import (
+	"testing"
+
+	"mnlr.de/addressserver/parse"
+	"mnlr.de/addressserver/sql"
+)
+
+func TestRate(t *testing.T) {
+	addr := sql.Address{Street: "Hauptmarkt", HouseNumber: "5", City: "Nürnberg", Postcode: "90403"}
+	tests := []struct {
+		query          string
+		wantConfidence float64
+		wantMatchType  string
+	}{
+		{"Hauptmarkt 5, 90403 Nürnberg", 1, matchExact},
+		{"Hauptmarkt 5 Nürnberg", 1, matchExact},
+		{"Hauptmarkt 7 Nürnberg", 0.67, matchHouseNumberMismatch},
+		{"Hauptmarkt Nürnberg", 0.7, matchStreetOnly},
+		{"(Hauptmarkt)", 0.7, matchStreetOnly},
+		{"Hauptmarkt*", 0.7, matchStreetOnly},
+		{"Hauptm", 0.35, matchStreetOnly},
+		{"Nürnberg", 0.3, matchCityOnly},
+		{"90403", 0.3, matchCityOnly},
+	}
+	for _, tt := range tests {
+		result := SearchResult{Address: addr}
+		rate(&result, parse.Address(tt.query))
+		if result.Confidence != tt.wantConfidence || result.MatchType != tt.wantMatchType {
+			t.Errorf("rate(%q) = %v, %q, want %v, %q", tt.query, result.Confidence, result.MatchType, tt.wantConfidence, tt.wantMatchType)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"mnlr.de/addressserver/sql"
+)
+
+// maxAreaVertices limits the positions of an area, every candidate address is
+// checked against all edges of its polygon
+const maxAreaVertices = 10000
+
+// GeoJSONGeometry is a GeoJSON Polygon or MultiPolygon in longitude, latitude order.
+type GeoJSONGeometry struct {
+	Type        string          `json:"type" enum:"Polygon,MultiPolygon" doc:"Geometry type"`
+	Coordinates json.RawMessage `json:"coordinates" doc:"Rings of the polygon, or polygons of the multipolygon, as [longitude, latitude] positions. The first ring of a polygon is its outline, the others are holes."`
+}
+
+// area converts the geometry to the polygons it covers.
+func (g GeoJSONGeometry) area() (sql.Area, error) {
+	var polygons [][][][]float64
+	switch g.Type {
+	case "Polygon":
+		var polygon [][][]float64
+		if err := json.Unmarshal(g.Coordinates, &polygon); err != nil {
+			return nil, errors.New("coordinates of a Polygon must be an array of rings of [longitude, latitude] positions")
+		}
+		polygons = [][][][]float64{polygon}
+	case "MultiPolygon":
+		if err := json.Unmarshal(g.Coordinates, &polygons); err != nil {
+			return nil, errors.New("coordinates of a MultiPolygon must be an array of polygons of rings of [longitude, latitude] positions")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported geometry type %q, use Polygon or MultiPolygon", g.Type)
+	}
+	if len(polygons) == 0 {
+		return nil, errors.New("the geometry contains no polygon")
+	}
+
+	vertices := 0
+	area := make(sql.Area, len(polygons))
+	for i, polygon := range polygons {
+		if len(polygon) == 0 {
+			return nil, fmt.Errorf("polygon %d has no rings", i)
+		}
+		for j, positions := range polygon {
+			vertices += len(positions)
+			if vertices > maxAreaVertices {
+				return nil, fmt.Errorf("the geometry has more than %d positions", maxAreaVertices)
+			}
+			ring, err := parseRing(positions)
+			if err != nil {
+				return nil, fmt.Errorf("polygon %d ring %d: %w", i, j, err)
+			}
+			if j == 0 {
+				area[i].Outer = ring
+			} else {
+				area[i].Holes = append(area[i].Holes, ring)
+			}
+		}
+	}
+	return area, nil
+}
+
+// parseRing validates the positions of a linear ring and returns its points
+// without the closing position.
+func parseRing(positions [][]float64) ([]sql.Point, error) {
+	if len(positions) < 4 {
+		return nil, errors.New("a ring needs at least four positions")
+	}
+	ring := make([]sql.Point, len(positions))
+	for i, position := range positions {
+		// Further values like the altitude are ignored
+		if len(position) < 2 {
+			return nil, fmt.Errorf("position %d must be [longitude, latitude]", i)
+		}
+		if err := checkCoordinate(position[1], position[0]); err != nil {
+			return nil, fmt.Errorf("position %d: %w", i, err)
+		}
+		ring[i] = sql.Point{Longitude: position[0], Latitude: position[1]}
+	}
+	if ring[0] != ring[len(ring)-1] {
+		return nil, errors.New("the first and last position of a ring must be equal")
+	}
+	return ring[:len(ring)-1], nil
+}
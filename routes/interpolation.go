@@ -0,0 +1,54 @@
+package routes
+
+import (
+	"sort"
+
+	"mnlr.de/addressserver/normalize"
+	"mnlr.de/addressserver/parse"
+	"mnlr.de/addressserver/sql"
+)
+
+// interpolationStreets is the number of matching streets a missing house number is interpolated on
+const interpolationStreets = 10
+
+// interpolate estimates the position of the house number of c missing in the
+// database on every street matching the street, city, postcode and remaining
+// words of c, most accurate first. With exact set, only streets and cities
+// with exactly the given names are used.
+func interpolate(c parse.Components, exact bool, limit int) ([]SearchResult, error) {
+	street, houseNumber, postcode, city := c.Street, c.HouseNumber, c.Postcode, c.City
+	streets, err := sql.MatchingStreets(sql.ColumnQuery{Street: street, Postcode: postcode, City: city, Text: c.Rest}, interpolationStreets)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []SearchResult
+	for _, s := range streets {
+		if exact && (s.Street != street || (city != "" && s.City != city)) {
+			continue
+		}
+		estimate, err := sql.InterpolateHouseNumber(s.Street, s.City, houseNumber)
+		if err != nil {
+			return nil, err
+		}
+		if estimate == nil || (postcode != "" && sql.HasPostcodes() && estimate.Address.Postcode != postcode) {
+			continue
+		}
+		accuracy := estimate.AccuracyM
+		results = append(results, SearchResult{Address: estimate.Address, Interpolated: true, AccuracyM: &accuracy})
+	}
+
+	// Prefer the streets named like the query, then the more accurate estimates
+	sort.SliceStable(results, func(i, j int) bool {
+		ei := normalize.Text(results[i].Street) == normalize.Text(street)
+		ej := normalize.Text(results[j].Street) == normalize.Text(street)
+		if ei != ej {
+			return ei
+		}
+		return *results[i].AccuracyM < *results[j].AccuracyM
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
@@ -0,0 +1,103 @@
+package routes
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/danielgtaylor/huma/v2"
+	"mnlr.de/addressserver/sql"
+)
+
+// OptionalParam is a query parameter that distinguishes between being absent
+// and being set to its zero value, e.g. a coordinate of 0.
+type OptionalParam[T any] struct {
+	Value T
+	IsSet bool
+}
+
+// Schema documents the parameter with the schema of its value type.
+func (o OptionalParam[T]) Schema(r huma.Registry) *huma.Schema {
+	return huma.SchemaFromType(r, reflect.TypeOf(o.Value))
+}
+
+// Receiver exposes Value to huma as the field the parameter is parsed into.
+func (o *OptionalParam[T]) Receiver() reflect.Value {
+	return reflect.ValueOf(o).Elem().Field(0)
+}
+
+// OnParamSet records whether the parameter was present in the request.
+func (o *OptionalParam[T]) OnParamSet(isSet bool, parsed any) {
+	o.IsSet = isSet
+}
+
+// parseBBox parses a bounding box given as "minLon,minLat,maxLon,maxLat".
+func parseBBox(s string) (*sql.BBox, error) {
+	values, err := parseFloats(s, 4)
+	if err != nil {
+		return nil, fmt.Errorf("bbox must be minLon,minLat,maxLon,maxLat: %w", err)
+	}
+	box := &sql.BBox{MinLon: values[0], MinLat: values[1], MaxLon: values[2], MaxLat: values[3]}
+	if box.MinLon > box.MaxLon || box.MinLat > box.MaxLat {
+		return nil, fmt.Errorf("bbox minimum must not be greater than its maximum")
+	}
+	if err := checkCoordinate(box.MinLat, box.MinLon); err != nil {
+		return nil, err
+	}
+	if err := checkCoordinate(box.MaxLat, box.MaxLon); err != nil {
+		return nil, err
+	}
+	return box, nil
+}
+
+// parsePoint parses a coordinate given as "lat,lon".
+func parsePoint(s string) (*sql.Point, error) {
+	values, err := parseFloats(s, 2)
+	if err != nil {
+		return nil, fmt.Errorf("point must be lat,lon: %w", err)
+	}
+	if err := checkCoordinate(values[0], values[1]); err != nil {
+		return nil, err
+	}
+	return &sql.Point{Latitude: values[0], Longitude: values[1]}, nil
+}
+
+// parseFloats parses exactly n comma separated finite numbers.
+func parseFloats(s string, n int) ([]float64, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != n {
+		return nil, fmt.Errorf("expected %d comma separated numbers", n)
+	}
+	values := make([]float64, n)
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("invalid number %q", part)
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// checkCoordinate validates the range of a latitude and longitude. The
+// comparisons are negated, so NaN is rejected as well.
+func checkCoordinate(lat, lon float64) error {
+	if !(lat >= -90 && lat <= 90) {
+		return fmt.Errorf("latitude must be between -90 and 90")
+	}
+	if !(lon >= -180 && lon <= 180) {
+		return fmt.Errorf("longitude must be between -180 and 180")
+	}
+	return nil
+}
+
+// checkFinite rejects NaN and infinite values of a float parameter, which
+// strconv.ParseFloat accepts and the minimum and maximum tags let through.
+func checkFinite(name string, v float64) error {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return fmt.Errorf("%s must be a finite number", name)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package routes
+
+import (
+	"reflect"
+	"testing"
+
+	"mnlr.de/addressserver/sql"
+)
+
+func TestParseBBox(t *testing.T) {
+	tests := []struct {
+		bbox    string
+		want    *sql.BBox
+		wantErr bool
+	}{
+		{"11.03,49.42,11.12,49.48", &sql.BBox{MinLon: 11.03, MinLat: 49.42, MaxLon: 11.12, MaxLat: 49.48}, false},
+		{" 11.03, 49.42 ,11.12,49.48", &sql.BBox{MinLon: 11.03, MinLat: 49.42, MaxLon: 11.12, MaxLat: 49.48}, false},
+		{"-180,-90,180,90", &sql.BBox{MinLon: -180, MinLat: -90, MaxLon: 180, MaxLat: 90}, false},
+		{"11.03,49.42,11.12", nil, true},
+		{"11.12,49.42,11.03,49.48", nil, true},
+		{"11.03,49.42,11.12,91", nil, true},
+		{"-181,49.42,11.12,49.48", nil, true},
+		{"NaN,NaN,NaN,NaN", nil, true},
+		{"11.03,49.42,11.12,nan", nil, true},
+		{"-Inf,49.42,Inf,49.48", nil, true},
+		{"a,b,c,d", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseBBox(tt.bbox)
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseBBox(%q) = %v, %v, want %v, error %v", tt.bbox, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParsePoint(t *testing.T) {
+	tests := []struct {
+		point   string
+		want    *sql.Point
+		wantErr bool
+	}{
+		{"49.4521,11.0767", &sql.Point{Latitude: 49.4521, Longitude: 11.0767}, false},
+		{"0,0", &sql.Point{}, false},
+		{"11.0767", nil, true},
+		{"91,11", nil, true},
+		{"49.45,181", nil, true},
+		{"NaN,NaN", nil, true},
+		{"49.45,Inf", nil, true},
+		{"49.45,+Infinity", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parsePoint(tt.point)
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parsePoint(%q) = %v, %v, want %v, error %v", tt.point, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
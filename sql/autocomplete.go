@@ -0,0 +1,49 @@
+package sql
+
+import (
+	"fmt"
+)
+
+// StreetInCity is a street of a city
+type StreetInCity struct {
+	Street string `json:"street"`
+	City   string `json:"city"`
+}
+
+// MatchingStreets returns up to limit distinct street and city combinations
+// with addresses matching query like ColumnSearch does. Instead of ranking all
+// matches it stops at the first limit combinations in index order, which keeps
+// it fast enough to be called on every keystroke.
+func MatchingStreets(query ColumnQuery, limit int) ([]StreetInCity, error) {
+	if limit <= 0 || limit > 1000 {
+		limit = 100 // Default limit with a maximum
+	}
+
+	expression, _ := query.expression()
+	if expression == "" {
+		return nil, nil
+	}
+
+	rows, err := db.Query(`
+		SELECT DISTINCT a.street, a.city
+		FROM address_norm_fts
+		JOIN addresses a ON a.id = address_norm_fts.rowid
+		WHERE address_norm_fts MATCH ?
+		LIMIT ?
+	`, expression, limit)
+	if err != nil {
+		return nil, fmt.Errorf("matching streets query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var streets []StreetInCity
+	for rows.Next() {
+		var s StreetInCity
+		if err := rows.Scan(&s.Street, &s.City); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		streets = append(streets, s)
+	}
+
+	return streets, nil
+}
@@ -0,0 +1,53 @@
+package sql
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// ErrInvalidCursor is returned when a pagination token cannot be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor marks the last row of a result page. Paged queries order their rows
+// by score and then by id, so continuing after (Score, ID) is stable even when
+// many rows share the same score.
+type Cursor struct {
+	Score float64 `json:"s"`
+	ID    int64   `json:"i"`
+}
+
+// Encode returns the cursor as an opaque, URL safe token
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a token created by Cursor.Encode.
+// An empty token yields a nil cursor, which starts at the first page.
+func DecodeCursor(token string) (*Cursor, error) {
+	if token == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// keysetFilter returns the WHERE clause and arguments that skip all rows up to
+// and including the cursor position. score and id name the ordering columns.
+func keysetFilter(after *Cursor, score, id string) (string, []interface{}) {
+	if after == nil {
+		return "1=1", nil
+	}
+	return "(" + score + " > ? OR (" + score + " = ? AND " + id + " > ?))",
+		[]interface{}{after.Score, after.Score, after.ID}
+}
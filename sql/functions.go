@@ -0,0 +1,42 @@
+package sql
+
+import (
+	"database/sql/driver"
+	"fmt"
+
+	"mnlr.de/addressserver/normalize"
+	"modernc.org/sqlite"
+)
+
+// init registers the Go functions the queries of this package call from SQL
+func init() {
+	// normalize_address(text) returns normalize.Text(text),
+	// it is used to fill the normalized fulltext index
+	sqlite.MustRegisterDeterministicScalarFunction("normalize_address", 1,
+		func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+			s, ok := args[0].(string)
+			if !ok {
+				return args[0], nil
+			}
+			return normalize.Text(s), nil
+		})
+
+	// distance_km(lat1, lon1, lat2, lon2) returns CalculateDistance for the two points
+	sqlite.MustRegisterDeterministicScalarFunction("distance_km", 4,
+		func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+			var coords [4]float64
+			for i, arg := range args {
+				switch v := arg.(type) {
+				case float64:
+					coords[i] = v
+				case int64:
+					coords[i] = float64(v)
+				case nil:
+					return nil, nil
+				default:
+					return nil, fmt.Errorf("distance_km: argument %d is not a number", i+1)
+				}
+			}
+			return CalculateDistance(coords[0], coords[1], coords[2], coords[3]), nil
+		})
+}
@@ -0,0 +1,239 @@
+package sql
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"mnlr.de/addressserver/normalize"
+)
+
+// FuzzyMatch represents a fuzzy search result together with the number of
+// character edits needed to turn the query words into the matched words
+type FuzzyMatch struct {
+	HighlightedMatch
+	Fuzziness int `json:"fuzziness"`
+}
+
+// fuzzyCandidates is the number of index terms compared per query word
+const fuzzyCandidates = 100
+
+// ensureTrigramIndex builds the trigram index used by FuzzySearch if the loaded
+// database doesn't contain it yet. It indexes every term of address_norm_fts, so
+// corrected words are always terms the normalized fulltext index knows.
+func ensureTrigramIndex(db *sql.DB) error {
+	exists, err := tableExists(db, "term_trigram")
+	if err != nil || exists {
+		return err
+	}
+
+	log.Println("Building trigram index for fuzzy search...")
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	statements := []string{
+		"CREATE VIRTUAL TABLE temp.address_vocab USING fts5vocab(main, address_norm_fts, 'row')",
+		"CREATE VIRTUAL TABLE term_trigram USING fts5(term, tokenize='trigram')",
+		// Terms containing digits are house numbers, they are always matched by prefix
+		"INSERT INTO term_trigram(term) SELECT term FROM temp.address_vocab WHERE term NOT GLOB '*[0-9]*' AND length(term) >= 3",
+		"DROP TABLE temp.address_vocab",
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to build trigram index: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit trigram index: %w", err)
+	}
+	log.Println("Trigram index built.")
+	return nil
+}
+
+// FuzzySearch performs a typo tolerant fulltext search. Every query word is
+// replaced by the index terms within a small edit distance, found through the
+// trigram index, and the results are re-ranked by their total edit distance.
+// The query is normalized like in AdvancedFulltextSearch.
+// Fuzzy results are not paginated, opts.After is ignored.
+func FuzzySearch(query string, opts SearchOptions) ([]FuzzyMatch, error) {
+	if opts.Limit <= 0 || opts.Limit > 1000 {
+		opts.Limit = 100 // Default limit with a maximum
+	}
+
+	words := strings.Fields(normalize.Text(query))
+	if len(words) == 0 {
+		return nil, nil
+	}
+
+	// Corrections maps every query word to its candidate terms and their distances
+	corrections := make([]map[string]int, len(words))
+	var groups []string
+	highlightTerms := append([]string(nil), words...)
+	for i, word := range words {
+		terms, err := fuzzyTerms(word)
+		if err != nil {
+			return nil, err
+		}
+		corrections[i] = terms
+
+		var alternatives []string
+		for term := range terms {
+			alternatives = append(alternatives, quoteTerm(term))
+			highlightTerms = append(highlightTerms, term)
+		}
+		sort.Strings(alternatives)
+		// Keep prefix matching for the word as typed, like the regular search does
+		alternatives = append(alternatives, quoteTerm(word)+"*")
+		groups = append(groups, "("+strings.Join(alternatives, " OR ")+")")
+	}
+
+	// Fetch a wide page ordered by rank, the edit distance decides the final order
+	inner := opts
+	inner.Limit = 1000
+	inner.After = nil
+	matches, _, err := matchFulltext(strings.Join(groups, " AND "), highlightTerms, inner)
+	if err != nil {
+		return nil, fmt.Errorf("fuzzy search failed: %w", err)
+	}
+
+	results := make([]FuzzyMatch, len(matches))
+	for i, m := range matches {
+		results[i] = FuzzyMatch{HighlightedMatch: m, Fuzziness: fuzziness(words, corrections, m.Address)}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Fuzziness < results[j].Fuzziness
+	})
+
+	if len(results) > opts.Limit {
+		results = results[:opts.Limit]
+	}
+	return results, nil
+}
+
+// fuzzyTerms looks up the index terms within the allowed edit distance of word
+func fuzzyTerms(word string) (map[string]int, error) {
+	terms := make(map[string]int)
+	trigrams := trigramsOf(word)
+	if len(trigrams) == 0 || strings.IndexFunc(word, unicode.IsDigit) >= 0 {
+		return terms, nil
+	}
+
+	rows, err := db.Query(
+		"SELECT term FROM term_trigram WHERE term_trigram MATCH ? ORDER BY rank LIMIT ?",
+		strings.Join(trigrams, " OR "), fuzzyCandidates,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("trigram lookup failed: %w", err)
+	}
+	defer rows.Close()
+
+	maxEdits := maxEditsFor(word)
+	for rows.Next() {
+		var term string
+		if err := rows.Scan(&term); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		if d := wordDistance(word, term); d <= maxEdits {
+			terms[term] = d
+		}
+	}
+	return terms, rows.Err()
+}
+
+// fuzziness returns the total edit distance between the query words and the
+// best matching words of the address
+func fuzziness(words []string, corrections []map[string]int, addr Address) int {
+	tokens := strings.Fields(normalize.Text(addr.Street + " " + addr.HouseNumber + " " + addr.City + " " + addr.Postcode))
+
+	total := 0
+	for i, word := range words {
+		best := -1
+		for _, token := range tokens {
+			d, ok := corrections[i][token]
+			if strings.HasPrefix(token, word) {
+				d, ok = 0, true
+			}
+			if ok && (best < 0 || d < best) {
+				best = d
+			}
+		}
+		if best < 0 {
+			// The word matched a token the address tokenizer splits differently,
+			// fall back to the closest edit distance
+			for _, token := range tokens {
+				if d := wordDistance(word, token); best < 0 || d < best {
+					best = d
+				}
+			}
+		}
+		total += best
+	}
+	return total
+}
+
+// maxEditsFor returns how many edits are tolerated for a word of this length
+func maxEditsFor(word string) int {
+	switch n := utf8.RuneCountInString(word); {
+	case n <= 4:
+		return 1
+	case n <= 8:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// wordDistance returns the edit distance between a typed word and an index term.
+// A word that is a misspelled prefix of the term is compared against the prefix
+// only, so partially typed words are not penalized for the missing rest.
+func wordDistance(word, term string) int {
+	d := levenshtein(word, term)
+	w, t := []rune(word), []rune(term)
+	if len(t) > len(w) {
+		if p := levenshtein(word, string(t[:len(w)])); p < d {
+			d = p
+		}
+	}
+	return d
+}
+
+// levenshtein returns the number of single character insertions, deletions
+// and substitutions needed to turn a into b
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// trigramsOf returns the quoted trigrams of word as FTS5 strings
+func trigramsOf(word string) []string {
+	runes := []rune(word)
+	var trigrams []string
+	for i := 0; i+3 <= len(runes); i++ {
+		trigrams = append(trigrams, quoteTerm(string(runes[i:i+3])))
+	}
+	return trigrams
+}
@@ -0,0 +1,104 @@
+package sql
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Info describes the loaded database
+type Info struct {
+	AddressCount  int64             `json:"address_count"`
+	CityCount     int64             `json:"city_count"`
+	FileSize      int64             `json:"file_size"`      // Size of the database file in bytes
+	BBox          *BBox             `json:"bbox,omitempty"` // Area covered by the addresses, absent if there are none
+	HasPostcodes  bool              `json:"postcodes"`
+	SchemaVersion int64             `json:"schema_version"` // PRAGMA user_version of the database
+	Metadata      map[string]string `json:"metadata,omitempty"`
+	LoadedAt      time.Time         `json:"loaded_at"`
+}
+
+var (
+	// loadedAt is the time Init loaded the current database
+	loadedAt time.Time
+
+	// stats caches the counts and area of the loaded database, they take a
+	// full scan of the addresses table. Init resets it.
+	stats   *Info
+	statsMu sync.Mutex
+)
+
+// resetInfo forgets the statistics of the previous database
+func resetInfo() {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	stats = nil
+	loadedAt = time.Now().UTC()
+}
+
+// GetInfo returns the statistics and metadata of the loaded database. The
+// statistics are computed on the first call after the database was loaded.
+func GetInfo() (*Info, error) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+
+	if stats == nil {
+		info := &Info{HasPostcodes: hasPostcode, LoadedAt: loadedAt}
+		var minLon, minLat, maxLon, maxLat *float64
+		err := db.QueryRow("SELECT COUNT(*), MIN(longitude), MIN(latitude), MAX(longitude), MAX(latitude) FROM addresses").
+			Scan(&info.AddressCount, &minLon, &minLat, &maxLon, &maxLat)
+		if err != nil {
+			return nil, fmt.Errorf("statistics query failed: %w", err)
+		}
+		if minLon != nil {
+			info.BBox = &BBox{MinLon: *minLon, MinLat: *minLat, MaxLon: *maxLon, MaxLat: *maxLat}
+		}
+		if err := db.QueryRow("SELECT COUNT(DISTINCT city) FROM addresses").Scan(&info.CityCount); err != nil {
+			return nil, fmt.Errorf("city count query failed: %w", err)
+		}
+		if err := db.QueryRow("PRAGMA user_version").Scan(&info.SchemaVersion); err != nil {
+			return nil, fmt.Errorf("schema version query failed: %w", err)
+		}
+		if info.Metadata, err = readMetadata(); err != nil {
+			log.Printf("Warning: ignoring database metadata: %v", err)
+		}
+		stats = info
+	}
+
+	// The file size changes while indexes are built, so it is always read fresh
+	info := *stats
+	if fi, err := os.Stat(dbpath); err == nil {
+		info.FileSize = fi.Size()
+	}
+	return &info, nil
+}
+
+// readMetadata returns the key value pairs of the metadata table written by
+// the import, nil if the database has none
+func readMetadata() (map[string]string, error) {
+	exists, err := tableExists(db, "metadata")
+	if err != nil || !exists {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT key, value FROM metadata")
+	if err != nil {
+		return nil, fmt.Errorf("metadata query failed: %w", err)
+	}
+	defer rows.Close()
+
+	metadata := make(map[string]string)
+	for rows.Next() {
+		var key string
+		var value *string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		if value != nil {
+			metadata[key] = *value
+		}
+	}
+	return metadata, rows.Err()
+}
@@ -0,0 +1,129 @@
+package sql
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	// minAccuracyM is the best accuracy claimed for an interpolated position
+	minAccuracyM = 5.0
+	// otherSideAccuracyM is added when the position had to be interpolated
+	// between numbers of the other side of the street, roughly a street width
+	otherSideAccuracyM = 15.0
+)
+
+// Interpolation is the estimated position of a house number that is missing
+// in the database
+type Interpolation struct {
+	Address   Address // The estimated address, its ID is 0
+	AccuracyM float64 // Estimated error of the position in meters
+}
+
+// houseNumber is the sortable value of a house number like "17" or "17a"
+type houseNumber struct {
+	number int     // Leading digits
+	value  float64 // number with the letter suffix as fraction, 17a is 17.04
+}
+
+// parseHouseNumber returns the value of a house number starting with digits
+func parseHouseNumber(s string) (houseNumber, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	end := strings.IndexFunc(s, func(r rune) bool { return !unicode.IsDigit(r) })
+	if end < 0 {
+		end = len(s)
+	}
+	n, err := strconv.Atoi(s[:end])
+	if err != nil {
+		return houseNumber{}, false
+	}
+	h := houseNumber{number: n, value: float64(n)}
+	if rest := strings.TrimSpace(s[end:]); rest != "" && rest[0] >= 'a' && rest[0] <= 'z' {
+		h.value += float64(rest[0]-'a'+1) / 27
+	}
+	return h, true
+}
+
+// InterpolateHouseNumber estimates the position of a house number on a street
+// of a city from the closest lower and higher house numbers on the same side
+// of the street, which is told by the parity of the numbers. If the number
+// cannot be enclosed by numbers of its own side, both sides are used with a
+// correspondingly worse accuracy. Street and city must be given exactly as
+// stored. It returns nil if the number exists or cannot be enclosed at all.
+func InterpolateHouseNumber(street, city, number string) (*Interpolation, error) {
+	target, ok := parseHouseNumber(number)
+	if !ok {
+		return nil, nil
+	}
+
+	rows, err := db.Query("SELECT "+addressColumns("a")+" FROM addresses a WHERE a.street = ? AND a.city = ?", street, city)
+	if err != nil {
+		return nil, fmt.Errorf("interpolation query failed: %w", err)
+	}
+	defer rows.Close()
+
+	// Closest lower and higher numbers, on the same side and on any side
+	var below, above, belowAny, aboveAny *Address
+	var belowValue, aboveValue, belowAnyValue, aboveAnyValue float64
+	for rows.Next() {
+		var addr Address
+		if err := rows.Scan(addr.fields()...); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		h, ok := parseHouseNumber(addr.HouseNumber)
+		switch {
+		case !ok:
+			continue
+		case h.value == target.value:
+			return nil, nil // The number exists
+		case h.value < target.value:
+			if belowAny == nil || h.value > belowAnyValue {
+				belowAny, belowAnyValue = &addr, h.value
+			}
+			if h.number%2 == target.number%2 && (below == nil || h.value > belowValue) {
+				below, belowValue = &addr, h.value
+			}
+		default:
+			if aboveAny == nil || h.value < aboveAnyValue {
+				aboveAny, aboveAnyValue = &addr, h.value
+			}
+			if h.number%2 == target.number%2 && (above == nil || h.value < aboveValue) {
+				above, aboveValue = &addr, h.value
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("interpolation query failed: %w", err)
+	}
+
+	extraAccuracy := 0.0
+	if below == nil || above == nil {
+		below, above, belowValue, aboveValue = belowAny, aboveAny, belowAnyValue, aboveAnyValue
+		extraAccuracy = otherSideAccuracyM
+	}
+	if below == nil || above == nil {
+		return nil, nil
+	}
+
+	// Place the number linearly between its neighbours. The error grows with
+	// the distance to the closer neighbour.
+	t := (target.value - belowValue) / (aboveValue - belowValue)
+	span := CalculateDistance(below.Latitude, below.Longitude, above.Latitude, above.Longitude) * 1000
+	result := &Interpolation{
+		Address: Address{
+			Street:      street,
+			HouseNumber: strings.ToLower(strings.TrimSpace(number)),
+			City:        city,
+			Latitude:    below.Latitude + t*(above.Latitude-below.Latitude),
+			Longitude:   below.Longitude + t*(above.Longitude-below.Longitude),
+		},
+		AccuracyM: math.Max(span*math.Min(t, 1-t), minAccuracyM) + extraAccuracy,
+	}
+	if below.Postcode == above.Postcode {
+		result.Address.Postcode = below.Postcode
+	}
+	return result, nil
+}
@@ -0,0 +1,92 @@
+package sql
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+
+	"mnlr.de/addressserver/normalize"
+)
+
+// ensureNormalizedIndex builds the normalized fulltext index if the loaded
+// database doesn't contain it yet. address_norm_fts holds the street, house
+// number, city and, if the database has postcodes, the postcode of every
+// address in the form produced by normalize.Text and is contentless, the
+// addresses are always read from the addresses table. An index whose postcode
+// column doesn't match postcodes, whether the addresses table has them, is rebuilt.
+func ensureNormalizedIndex(db *sql.DB, postcodes bool) error {
+	exists, err := tableExists(db, "address_norm_fts")
+	if err != nil {
+		return err
+	}
+	if exists {
+		indexed, err := columnExists(db, "address_norm_fts", "postcode")
+		if err != nil || indexed == postcodes {
+			return err
+		}
+	}
+
+	log.Println("Building normalized fulltext index...")
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	columns := "street, house_number, city"
+	values := "normalize_address(street), normalize_address(house_number), normalize_address(city)"
+	if postcodes {
+		columns += ", postcode"
+		values += ", postcode"
+	}
+	statements := []string{
+		"DROP TABLE IF EXISTS address_norm_fts",
+		`CREATE VIRTUAL TABLE address_norm_fts USING fts5(
+			` + columns + `,
+			content='',
+			tokenize="unicode61 remove_diacritics 0 tokenchars '-'"
+		)`,
+		`INSERT INTO address_norm_fts(rowid, ` + columns + `)
+			SELECT id, ` + values + `
+			FROM addresses`,
+		// The trigram index is derived from this index and has to be rebuilt with it
+		"DROP TABLE IF EXISTS term_trigram",
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to build normalized index: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit normalized index: %w", err)
+	}
+	log.Println("Normalized fulltext index built.")
+	return nil
+}
+
+// highlightText wraps every word of text whose normalized form starts with one
+// of the normalized terms in the start and end markers
+func highlightText(text string, terms []string, start, end string) string {
+	words := strings.Split(text, " ")
+	for i, word := range words {
+		// Punctuation around the word is kept outside of the markers
+		core := strings.TrimFunc(word, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		if core == "" {
+			continue
+		}
+		normalized := normalize.Word(core)
+		for _, term := range terms {
+			if strings.HasPrefix(normalized, term) {
+				at := strings.Index(word, core)
+				words[i] = word[:at] + start + core + end + word[at+len(core):]
+				break
+			}
+		}
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,166 @@
+package sql
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// ErrNoPostcodes is returned by postcode filters and lookups if the loaded
+// database has no postcode column
+var ErrNoPostcodes = errors.New("the loaded database contains no postcodes")
+
+// hasPostcode is set by Init if the addresses table has a postcode column
+var hasPostcode bool
+
+// HasPostcodes reports whether the loaded database contains postcodes
+func HasPostcodes() bool {
+	return hasPostcode
+}
+
+// ensurePostcodeIndex creates the index used to look up and list postcodes
+// if the loaded database doesn't contain it yet
+func ensurePostcodeIndex(db *sql.DB) error {
+	exists, err := indexExists(db, "idx_postcode_city")
+	if err != nil || exists {
+		return err
+	}
+
+	log.Println("Building postcode index...")
+	if _, err := db.Exec("CREATE INDEX idx_postcode_city ON addresses(postcode, city)"); err != nil {
+		return fmt.Errorf("failed to build postcode index: %w", err)
+	}
+	log.Println("Postcode index built.")
+	return nil
+}
+
+// indexExists reports whether an index with the given name exists
+func indexExists(db *sql.DB, name string) (bool, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = ?", name).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to check for index %s: %w", name, err)
+	}
+	return count > 0, nil
+}
+
+// PostcodeSummary represents a postcode with the cities it covers
+type PostcodeSummary struct {
+	Postcode     string   `json:"postcode"`
+	AddressCount int64    `json:"address_count"`
+	Cities       []string `json:"cities"` // Ordered by their number of addresses, most first
+}
+
+// PostcodeDetail represents a postcode with the area its addresses cover
+type PostcodeDetail struct {
+	PostcodeSummary
+	Center Point `json:"center"` // Mean position of the addresses
+	BBox   BBox  `json:"bbox"`
+}
+
+// ListPostcodes returns up to limit postcodes starting with prefix in
+// ascending order, beginning after the postcode after. An empty prefix
+// matches all postcodes, an empty after starts at the first one.
+// The returned next postcode continues the list and is empty on the last page.
+func ListPostcodes(prefix, after string, limit int) ([]PostcodeSummary, string, error) {
+	if !hasPostcode {
+		return nil, "", ErrNoPostcodes
+	}
+	if limit <= 0 || limit > 1000 {
+		limit = 100 // Default limit with a maximum
+	}
+
+	// Grouping along idx_postcode_city streams the groups in order,
+	// so reading stops once limit postcodes are complete
+	rows, err := db.Query(`
+		SELECT postcode, city, COUNT(*) AS count
+		FROM addresses
+		WHERE postcode GLOB ? AND postcode > ?
+		GROUP BY postcode, city
+		ORDER BY postcode, city
+	`, escapeGlob(prefix)+"*", after)
+	if err != nil {
+		return nil, "", fmt.Errorf("list postcodes failed: %w", err)
+	}
+	defer rows.Close()
+
+	var postcodes []PostcodeSummary
+	var next string
+	var counts []int64 // Address count of each city of the last postcode
+	for rows.Next() {
+		var postcode, city string
+		var count int64
+		if err := rows.Scan(&postcode, &city, &count); err != nil {
+			return nil, "", fmt.Errorf("scan failed: %w", err)
+		}
+		if len(postcodes) == 0 || postcodes[len(postcodes)-1].Postcode != postcode {
+			if len(postcodes) == limit {
+				next = postcodes[len(postcodes)-1].Postcode
+				break
+			}
+			postcodes = append(postcodes, PostcodeSummary{Postcode: postcode})
+			counts = counts[:0]
+		}
+		last := &postcodes[len(postcodes)-1]
+		last.AddressCount += count
+
+		// Insert the city at the position of its count
+		i := len(counts)
+		for i > 0 && counts[i-1] < count {
+			i--
+		}
+		counts = append(counts[:i], append([]int64{count}, counts[i:]...)...)
+		last.Cities = append(last.Cities[:i], append([]string{city}, last.Cities[i:]...)...)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("list postcodes failed: %w", err)
+	}
+	return postcodes, next, nil
+}
+
+// GetPostcode returns the cities and area of a postcode, or nil if no
+// address has this postcode
+func GetPostcode(postcode string) (*PostcodeDetail, error) {
+	if !hasPostcode {
+		return nil, ErrNoPostcodes
+	}
+
+	detail := PostcodeDetail{PostcodeSummary: PostcodeSummary{Postcode: postcode}}
+	err := db.QueryRow(`
+		SELECT COUNT(*), COALESCE(AVG(latitude), 0), COALESCE(AVG(longitude), 0),
+		       COALESCE(MIN(longitude), 0), COALESCE(MIN(latitude), 0),
+		       COALESCE(MAX(longitude), 0), COALESCE(MAX(latitude), 0)
+		FROM addresses
+		WHERE postcode = ?
+	`, postcode).Scan(&detail.AddressCount, &detail.Center.Latitude, &detail.Center.Longitude,
+		&detail.BBox.MinLon, &detail.BBox.MinLat, &detail.BBox.MaxLon, &detail.BBox.MaxLat)
+	if err != nil {
+		return nil, fmt.Errorf("postcode lookup failed: %w", err)
+	}
+	if detail.AddressCount == 0 {
+		return nil, nil // No address found
+	}
+
+	rows, err := db.Query(`
+		SELECT city FROM addresses
+		WHERE postcode = ?
+		GROUP BY city
+		ORDER BY COUNT(*) DESC, city
+	`, postcode)
+	if err != nil {
+		return nil, fmt.Errorf("postcode cities query failed: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var city string
+		if err := rows.Scan(&city); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		detail.Cities = append(detail.Cities, city)
+	}
+
+	return &detail, rows.Err()
+}
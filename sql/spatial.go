@@ -0,0 +1,190 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+)
+
+// spatialIndexCacheKiB is the page cache used while the spatial index is
+// built, as negative number of KiB like PRAGMA cache_size expects
+const spatialIndexCacheKiB = -256 * 1024
+
+// hasSpatialIndex is set by Init if the R*Tree index of the positions is available
+var hasSpatialIndex bool
+
+// ensureSpatialIndex builds the spatial index if the loaded database doesn't
+// contain it yet. address_rtree is an R*Tree holding the position of every
+// address as a box of zero size under the address ID, so the addresses in an
+// area are found without scanning the addresses table.
+func ensureSpatialIndex(db *sql.DB) error {
+	exists, err := tableExists(db, "address_rtree")
+	if err != nil || exists {
+		return err
+	}
+
+	log.Println("Building spatial index...")
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to build spatial index: %w", err)
+	}
+	defer conn.Close()
+
+	// The R*Tree pages are updated all over the tree while it is filled, with
+	// the default cache they are written and read again for every address
+	var cacheSize int64
+	if err := conn.QueryRowContext(ctx, "PRAGMA cache_size").Scan(&cacheSize); err != nil {
+		return fmt.Errorf("failed to build spatial index: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("PRAGMA cache_size = %d", spatialIndexCacheKiB)); err != nil {
+		return fmt.Errorf("failed to build spatial index: %w", err)
+	}
+	defer conn.ExecContext(ctx, fmt.Sprintf("PRAGMA cache_size = %d", cacheSize))
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	statements := []string{
+		"CREATE VIRTUAL TABLE address_rtree USING rtree(id, min_lon, max_lon, min_lat, max_lat)",
+		`INSERT INTO address_rtree(id, min_lon, max_lon, min_lat, max_lat)
+			SELECT id, longitude, longitude, latitude, latitude
+			FROM addresses
+			WHERE longitude IS NOT NULL AND latitude IS NOT NULL`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to build spatial index: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit spatial index: %w", err)
+	}
+	log.Println("Spatial index built.")
+	return nil
+}
+
+// maxQueryBoxes is the number of boxes up to which the R*Tree is searched with
+// a compound SELECT of one term per box. SQLite allows at most 500 terms, more
+// boxes are passed as one JSON array.
+const maxQueryBoxes = 100
+
+// boxCondition returns the SQL condition selecting the addresses inside any
+// of the boxes from the addresses table aliased as alias. The R*Tree stores
+// 32 bit floats rounded outwards, so its candidates are checked against the
+// exact coordinates; without the index all addresses are checked.
+func boxCondition(alias string, boxes ...BBox) (string, []interface{}) {
+	if hasSpatialIndex && len(boxes) > maxQueryBoxes {
+		// Every candidate is only checked against the box it was found in,
+		// checking it against all boxes takes far longer
+		return alias + `.id IN (
+			SELECT r.id FROM json_each(?) b
+			CROSS JOIN address_rtree r
+			JOIN addresses e ON e.id = r.id
+			WHERE ` + rtreeInJSONBox + ` AND ` + addressInJSONBox + `
+		)`, []interface{}{boxesJSON(boxes)}
+	}
+
+	condition, args := exactBoxCondition(alias, boxes)
+	if !hasSpatialIndex {
+		return condition, args
+	}
+	candidates, candidateArgs := rtreeCandidates(boxes)
+	return alias + ".id IN (" + candidates + ") AND " + condition, append(candidateArgs, args...)
+}
+
+// exactBoxCondition returns the SQL condition comparing the coordinates of the
+// addresses table aliased as alias with the boxes
+func exactBoxCondition(alias string, boxes []BBox) (string, []interface{}) {
+	var groups []string
+	var args []interface{}
+	// Every OR adds a level to the expression, so they are nested in groups
+	// of at most maxQueryBoxes boxes
+	for start := 0; start < len(boxes); start += maxQueryBoxes {
+		var conditions []string
+		for _, box := range boxes[start:min(start+maxQueryBoxes, len(boxes))] {
+			conditions = append(conditions, alias+".longitude BETWEEN ? AND ? AND "+alias+".latitude BETWEEN ? AND ?")
+			args = append(args, box.MinLon, box.MaxLon, box.MinLat, box.MaxLat)
+		}
+		groups = append(groups, "("+strings.Join(conditions, ") OR (")+")")
+	}
+	return "((" + strings.Join(groups, ") OR (") + "))", args
+}
+
+// rtreeCandidates returns the query listing the IDs the R*Tree finds in the
+// boxes. An ID is listed once per box containing it.
+func rtreeCandidates(boxes []BBox) (string, []interface{}) {
+	if len(boxes) > maxQueryBoxes {
+		// CROSS JOIN makes SQLite search the R*Tree once per box instead of
+		// comparing every entry of the R*Tree with all boxes
+		return "SELECT r.id FROM json_each(?) b CROSS JOIN address_rtree r WHERE " + rtreeInJSONBox,
+			[]interface{}{boxesJSON(boxes)}
+	}
+
+	var queries []string
+	var args []interface{}
+	for _, box := range boxes {
+		queries = append(queries, "SELECT id FROM address_rtree WHERE min_lon <= ? AND max_lon >= ? AND min_lat <= ? AND max_lat >= ?")
+		args = append(args, box.MaxLon, box.MinLon, box.MaxLat, box.MinLat)
+	}
+	return strings.Join(queries, " UNION ALL "), args
+}
+
+// boxesJSON returns the boxes as JSON array of [minLon, minLat, maxLon, maxLat]
+// arrays for json_each
+func boxesJSON(boxes []BBox) string {
+	values := make([][4]float64, len(boxes))
+	for i, box := range boxes {
+		values[i] = [4]float64{box.MinLon, box.MinLat, box.MaxLon, box.MaxLat}
+	}
+	data, _ := json.Marshal(values)
+	return string(data)
+}
+
+const (
+	// rtreeInJSONBox compares the R*Tree entry r with the box b of json_each
+	rtreeInJSONBox = "r.min_lon <= b.value->>2 AND r.max_lon >= b.value->>0 AND r.min_lat <= b.value->>3 AND r.max_lat >= b.value->>1"
+	// addressInJSONBox compares the address e with the box b of json_each
+	addressInJSONBox = "e.longitude BETWEEN b.value->>0 AND b.value->>2 AND e.latitude BETWEEN b.value->>1 AND b.value->>3"
+)
+
+const (
+	// nearestStartKm is the radius of the first search for the nearest addresses
+	nearestStartKm = 0.1
+	// nearestGrowth is the factor the radius grows by while too few addresses are found
+	nearestGrowth = 2.0
+	// maxDistanceKm is half the circumference of the earth, no point is farther away
+	maxDistanceKm = 20038.0
+)
+
+// FindNearestAddresses finds the k addresses nearest to a point, no matter how
+// far away they are, and returns them with their distances in km, nearest
+// first. The search starts with a small radius that grows until k addresses
+// are inside it, so dense areas only look at a few addresses. maxKm limits the
+// distance, 0 means unlimited; fewer than k addresses are returned if not
+// enough lie within it.
+func FindNearestAddresses(latitude, longitude float64, k int, maxKm float64) ([]Address, []float64, error) {
+	// The negated comparison also replaces NaN, which would never end the loop
+	if !(maxKm > 0 && maxKm <= maxDistanceKm) {
+		maxKm = maxDistanceKm
+	}
+
+	radiusKm := math.Min(nearestStartKm, maxKm)
+	for {
+		// All addresses outside the radius are farther away than the ones
+		// inside, so a full result within the radius is the nearest one
+		addresses, distances, _, err := findInRadius(latitude, longitude, radiusKm, 0, nil, k)
+		if err != nil || len(addresses) == k || radiusKm >= maxKm {
+			return addresses, distances, err
+		}
+		radiusKm = math.Min(radiusKm*nearestGrowth, maxKm)
+	}
+}
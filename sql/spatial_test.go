@@ -0,0 +1,220 @@
+package sql
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAround(t *testing.T) {
+	tests := []struct {
+		p        Point
+		radiusKm float64
+		want     []BBox
+	}{
+		{Point{Latitude: 0, Longitude: 179.99}, 11.1195, []BBox{
+			{MinLon: 179.89, MinLat: -0.1, MaxLon: 180, MaxLat: 0.1},
+			{MinLon: -180, MinLat: -0.1, MaxLon: -179.91, MaxLat: 0.1},
+		}},
+		{Point{Latitude: 0, Longitude: -179.99}, 11.1195, []BBox{
+			{MinLon: 179.91, MinLat: -0.1, MaxLon: 180, MaxLat: 0.1},
+			{MinLon: -180, MinLat: -0.1, MaxLon: -179.89, MaxLat: 0.1},
+		}},
+		{Point{Latitude: 49.45, Longitude: 11}, 20038, []BBox{{MinLon: -180, MinLat: -90, MaxLon: 180, MaxLat: 90}}},
+		{Point{Latitude: 49.45, Longitude: 11}, 5000, []BBox{{MinLon: -180, MinLat: 4.48, MaxLon: 180, MaxLat: 90}}},
+		{Point{Latitude: 89.95, Longitude: 11}, 10, []BBox{{MinLon: -180, MinLat: 89.86, MaxLon: 180, MaxLat: 90}}},
+	}
+	round := func(boxes []BBox) []BBox {
+		for i, b := range boxes {
+			boxes[i] = BBox{
+				MinLon: math.Round(b.MinLon*100) / 100, MinLat: math.Round(b.MinLat*100) / 100,
+				MaxLon: math.Round(b.MaxLon*100) / 100, MaxLat: math.Round(b.MaxLat*100) / 100,
+			}
+		}
+		return boxes
+	}
+	for _, tt := range tests {
+		if got := round(Around(tt.p, tt.radiusKm)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Around(%v, %v) = %v, want %v", tt.p, tt.radiusKm, got, tt.want)
+		}
+	}
+
+	// Every point within the radius has to be inside one of the boxes
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		p := Point{Latitude: r.Float64()*180 - 90, Longitude: r.Float64()*360 - 180}
+		q := Point{Latitude: p.Latitude + r.NormFloat64()*5, Longitude: p.Longitude + r.NormFloat64()*20}
+		q.Latitude = math.Max(-90, math.Min(90, q.Latitude))
+		q.Longitude = math.Mod(q.Longitude+540, 360) - 180
+		radiusKm := CalculateDistance(p.Latitude, p.Longitude, q.Latitude, q.Longitude) * (1 + 1e-9)
+		inside := false
+		for _, b := range Around(p, radiusKm) {
+			inside = inside || (q.Longitude >= b.MinLon && q.Longitude <= b.MaxLon && q.Latitude >= b.MinLat && q.Latitude <= b.MaxLat)
+		}
+		if !inside {
+			t.Fatalf("%v at %.3f km from %v is outside of %v", q, radiusKm, p, Around(p, radiusKm))
+		}
+	}
+}
+
+func TestFindNearestAddresses(t *testing.T) {
+	createTestDB(t, 2000)
+
+	for _, maxKm := range []float64{0, 20038, 100000, math.NaN(), math.Inf(1)} {
+		// Far away from all addresses, on the other side of the antimeridian
+		addresses, distances, err := FindNearestAddresses(-40, -170, 3, maxKm)
+		if err != nil {
+			t.Fatalf("maxKm %v: %v", maxKm, err)
+		}
+		if len(addresses) != 3 || distances[0] > distances[1] || distances[1] > distances[2] {
+			t.Errorf("maxKm %v: found %d addresses at %v km, want the 3 nearest", maxKm, len(addresses), distances)
+		}
+	}
+
+	addresses, _, err := FindNearestAddresses(49.45, 11.07, 3, 0.001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addresses) != 0 {
+		t.Errorf("found %d addresses within 1 m, want none", len(addresses))
+	}
+}
+
+var benchAddresses = flag.Int("addresses", 200000, "number of addresses in the synthetic benchmark database")
+
+// createTestDB writes a synthetic database with n addresses clustered around
+// 2000 towns spread over Germany and opens it with Init.
+func createTestDB(tb testing.TB, n int) {
+	tb.Helper()
+	path := filepath.Join(tb.TempDir(), "test.db")
+	d, err := sql.Open("sqlite", path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer d.Close()
+	for _, s := range []string{
+		"PRAGMA journal_mode = OFF",
+		"PRAGMA synchronous = OFF",
+		`CREATE TABLE addresses (id INTEGER PRIMARY KEY AUTOINCREMENT, street TEXT, house_number TEXT, city TEXT,
+			longitude REAL, latitude REAL, UNIQUE(street, house_number, city))`,
+	} {
+		if _, err := d.Exec(s); err != nil {
+			tb.Fatal(err)
+		}
+	}
+
+	r := rand.New(rand.NewSource(42))
+	type town struct{ latitude, longitude, spread float64 }
+	towns := make([]town, 2000)
+	for i := range towns {
+		towns[i] = town{47.5 + r.Float64()*7.5, 6 + r.Float64()*9, 0.01 + r.Float64()*0.08}
+	}
+	tx, err := d.Begin()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	stmt, err := tx.Prepare(`INSERT INTO addresses (street, house_number, city, longitude, latitude) VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		t := r.Intn(len(towns))
+		tw := towns[t]
+		_, err := stmt.Exec(fmt.Sprintf("Straße %d", i/100), fmt.Sprint(i%100+1), fmt.Sprintf("Ort %d", t),
+			tw.longitude+r.NormFloat64()*tw.spread, tw.latitude+r.NormFloat64()*tw.spread*0.6)
+		if err != nil {
+			tb.Fatal(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		tb.Fatal(err)
+	}
+	d.Close()
+
+	oldPath := dbpath
+	dbpath = path
+	tb.Cleanup(func() {
+		Close()
+		dbpath = oldPath
+	})
+	if err := Init(); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// fullScanRadius is the radius search without any prefilter, which
+// calculates the distance of every address in the table.
+func fullScanRadius(latitude, longitude, radiusKm float64, limit int) (int, error) {
+	rows, err := db.Query(`
+		SELECT `+addressColumns("a")+`, distance
+		FROM (
+			SELECT a.*, distance_km(?, ?, a.latitude, a.longitude) AS distance
+			FROM addresses a
+		) a
+		WHERE distance < ?
+		ORDER BY distance, id
+		LIMIT ?
+	`, latitude, longitude, radiusKm, limit)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	count := 0
+	for rows.Next() {
+		var addr Address
+		var distance float64
+		if err := rows.Scan(append(addr.fields(), &distance)...); err != nil {
+			return 0, err
+		}
+		count++
+	}
+	return count, rows.Err()
+}
+
+// BenchmarkRadiusSearch compares the radius search using the spatial index,
+// using only the bounding box on the coordinates and scanning the full table.
+// The database size can be changed with -addresses.
+func BenchmarkRadiusSearch(b *testing.B) {
+	createTestDB(b, *benchAddresses)
+	spatialIndex := hasSpatialIndex
+	defer func() { hasSpatialIndex = spatialIndex }()
+
+	search := map[string]func(latitude, longitude, radiusKm float64) error{
+		"rtree": func(latitude, longitude, radiusKm float64) error {
+			hasSpatialIndex = spatialIndex
+			_, _, _, err := findInRadius(latitude, longitude, radiusKm, 0, nil, 10)
+			return err
+		},
+		"bbox": func(latitude, longitude, radiusKm float64) error {
+			hasSpatialIndex = false
+			_, _, _, err := findInRadius(latitude, longitude, radiusKm, 0, nil, 10)
+			return err
+		},
+		"fullscan": func(latitude, longitude, radiusKm float64) error {
+			_, err := fullScanRadius(latitude, longitude, radiusKm, 10)
+			return err
+		},
+	}
+	if !spatialIndex {
+		b.Fatal("spatial index was not created")
+	}
+
+	for _, radius := range []float64{0.1, 1, 5} {
+		for _, name := range []string{"rtree", "bbox", "fullscan"} {
+			b.Run(fmt.Sprintf("%s/%gkm", name, radius), func(b *testing.B) {
+				r := rand.New(rand.NewSource(7))
+				for i := 0; i < b.N; i++ {
+					latitude, longitude := 47.5+r.Float64()*7.5, 6+r.Float64()*9
+					if err := search[name](latitude, longitude, radius); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"math"
 	"strings"
 
+	"mnlr.de/addressserver/normalize"
 	_ "modernc.org/sqlite"
 )
 
@@ -26,12 +27,78 @@ type Address struct {
 	City        string  `json:"city"`
 	Longitude   float64 `json:"longitude"`
 	Latitude    float64 `json:"latitude"`
+	Postcode    string  `json:"postcode,omitempty"` // Empty if unknown or the database has no postcodes
+}
+
+// addressColumns returns the columns scanned by Address.fields for the
+// addresses table aliased as alias. Databases without postcode column
+// yield an empty postcode.
+func addressColumns(alias string) string {
+	postcode := "''"
+	if hasPostcode {
+		postcode = "COALESCE(" + alias + ".postcode, '')"
+	}
+	return alias + ".id, " + alias + ".street, " + alias + ".house_number, " + alias + ".city, " +
+		alias + ".longitude, " + alias + ".latitude, " + postcode
+}
+
+// fields returns the scan destinations for the columns of addressColumns
+func (a *Address) fields() []interface{} {
+	return []interface{}{&a.ID, &a.Street, &a.HouseNumber, &a.City, &a.Longitude, &a.Latitude, &a.Postcode}
+}
+
+// Point is a geographic coordinate in degrees
+type Point struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// BBox is a rectangular area between two longitudes and two latitudes in degrees
+type BBox struct {
+	MinLon float64 `json:"min_lon"`
+	MinLat float64 `json:"min_lat"`
+	MaxLon float64 `json:"max_lon"`
+	MaxLat float64 `json:"max_lat"`
+}
+
+// Around returns the smallest boxes containing the circle of radiusKm around p.
+// A circle crossing the antimeridian is split into a box on either side of it,
+// a circle around a pole or wider than the earth covers all longitudes.
+func Around(p Point, radiusKm float64) []BBox {
+	const R = 6371.0 // Earth radius in kilometers, as in CalculateDistance
+	angle := radiusKm / R
+	dLat := angle * 180.0 / math.Pi
+	minLat, maxLat := math.Max(p.Latitude-dLat, -90), math.Min(p.Latitude+dLat, 90)
+
+	// The circle reaches farthest east and west where its meridians are
+	// tangent to it, which is asin(sin(angle) / cos(latitude)) away
+	sin, cos := math.Sin(angle), math.Cos(p.Latitude*math.Pi/180.0)
+	if minLat == -90 || maxLat == 90 || sin >= cos {
+		return []BBox{{MinLon: -180, MinLat: minLat, MaxLon: 180, MaxLat: maxLat}}
+	}
+	dLon := math.Asin(sin/cos) * 180.0 / math.Pi
+	minLon, maxLon := p.Longitude-dLon, p.Longitude+dLon
+	switch {
+	case minLon < -180:
+		return []BBox{
+			{MinLon: minLon + 360, MinLat: minLat, MaxLon: 180, MaxLat: maxLat},
+			{MinLon: -180, MinLat: minLat, MaxLon: maxLon, MaxLat: maxLat},
+		}
+	case maxLon > 180:
+		return []BBox{
+			{MinLon: minLon, MinLat: minLat, MaxLon: 180, MaxLat: maxLat},
+			{MinLon: -180, MinLat: minLat, MaxLon: maxLon - 360, MaxLat: maxLat},
+		}
+	}
+	return []BBox{{MinLon: minLon, MinLat: minLat, MaxLon: maxLon, MaxLat: maxLat}}
 }
 
 // Init initializes the database connection
 func Init() error {
-	var err error
-	db, err = sql.Open("sqlite", dbpath)
+	// The indexes are built on a new connection that replaces the previous one
+	// only when they are complete, so no query sees the new database without
+	// them or with the flags of the previous database
+	newDB, err := sql.Open("sqlite", dbpath)
 	if err != nil {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
@@ -47,17 +114,71 @@ func Init() error {
 	}
 
 	for _, pragma := range pragmas {
-		_, err = db.Exec(pragma)
+		_, err = newDB.Exec(pragma)
 		if err != nil {
-			db.Close()
+			newDB.Close()
 			log.Printf("Warning: failed to set pragma %s: %v", pragma, err)
 			return fmt.Errorf("failed to set pragma %s: %w", pragma, err)
 		}
 	}
 	log.Println("Database initialized with optimizations.")
+
+	// Older databases have no postcodes, the postcode column is only used if present
+	postcodes, err := columnExists(newDB, "addresses", "postcode")
+	if err != nil {
+		newDB.Close()
+		return err
+	}
+	if postcodes {
+		if err := ensurePostcodeIndex(newDB); err != nil {
+			log.Printf("Warning: postcode lookups will be slow: %v", err)
+		}
+	} else {
+		log.Println("Database has no postcode column, postcodes are unavailable.")
+	}
+
+	// Build the derived indexes missing from the loaded database. The search
+	// depends on the normalized index, without the trigram index only the
+	// fuzzy search fails.
+	if err := ensureNormalizedIndex(newDB, postcodes); err != nil {
+		newDB.Close()
+		return err
+	}
+	if err := ensureTrigramIndex(newDB); err != nil {
+		log.Printf("Warning: fuzzy search unavailable: %v", err)
+	}
+	spatialIndex := true
+	if err := ensureSpatialIndex(newDB); err != nil {
+		log.Printf("Warning: searches by position will be slow: %v", err)
+		spatialIndex = false
+	}
+
+	// Switch to the new database together with the flags describing it
+	db, hasPostcode, hasSpatialIndex = newDB, postcodes, spatialIndex
+	resetInfo()
 	return nil
 }
 
+// tableExists reports whether a table or virtual table with the given name exists
+func tableExists(db *sql.DB, name string) (bool, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to check for table %s: %w", name, err)
+	}
+	return count > 0, nil
+}
+
+// columnExists reports whether the table has a column with the given name
+func columnExists(db *sql.DB, table, column string) (bool, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to check for column %s.%s: %w", table, column, err)
+	}
+	return count > 0, nil
+}
+
 // Close closes the database connection
 func Close() error {
 	if db != nil {
@@ -66,28 +187,63 @@ func Close() error {
 	return nil
 }
 
+// AddressQuery holds the fields of a structured address search.
+// Empty fields are ignored.
+type AddressQuery struct {
+	Street      string
+	HouseNumber string
+	Postcode    string // Always matched exactly, requires a database with postcodes
+	City        string
+	Exact       bool // match street and city exactly instead of by prefix
+	Limit       int
+}
+
 // SearchByAddress searches for addresses by street, house number, and/or city
-func SearchByAddress(street, houseNumber, city string) ([]Address, error) {
+func SearchByAddress(q AddressQuery) ([]Address, error) {
+	if q.Limit <= 0 || q.Limit > 1000 {
+		q.Limit = 100 // Default limit with a maximum
+	}
+
+	if q.Postcode != "" && !hasPostcode {
+		return nil, ErrNoPostcodes
+	}
+
 	var addresses []Address
 	var args []interface{}
-	query := "SELECT id, street, house_number, city, longitude, latitude FROM addresses WHERE 1=1"
+	query := "SELECT " + addressColumns("a") + " FROM addresses a WHERE 1=1"
+
+	if q.Street != "" {
+		if q.Exact {
+			query += " AND a.street = ?"
+			args = append(args, q.Street)
+		} else {
+			query += ` AND a.street LIKE ? ESCAPE '\'`
+			args = append(args, escapeLike(q.Street)+"%")
+		}
+	}
 
-	if street != "" {
-		query += " AND street LIKE ?"
-		args = append(args, street+"%")
+	if q.HouseNumber != "" {
+		query += " AND a.house_number = ? COLLATE NOCASE"
+		args = append(args, q.HouseNumber)
 	}
 
-	if houseNumber != "" {
-		query += " AND house_number = ?"
-		args = append(args, houseNumber)
+	if q.Postcode != "" {
+		query += " AND a.postcode = ?"
+		args = append(args, q.Postcode)
 	}
 
-	if city != "" {
-		query += " AND city LIKE ?"
-		args = append(args, city+"%")
+	if q.City != "" {
+		if q.Exact {
+			query += " AND a.city = ?"
+			args = append(args, q.City)
+		} else {
+			query += ` AND a.city LIKE ? ESCAPE '\'`
+			args = append(args, escapeLike(q.City)+"%")
+		}
 	}
 
-	query += " LIMIT 100"
+	query += " LIMIT ?"
+	args = append(args, q.Limit)
 
 	rows, err := db.Query(query, args...)
 	if err != nil {
@@ -97,7 +253,7 @@ func SearchByAddress(street, houseNumber, city string) ([]Address, error) {
 
 	for rows.Next() {
 		var addr Address
-		if err := rows.Scan(&addr.ID, &addr.Street, &addr.HouseNumber, &addr.City, &addr.Longitude, &addr.Latitude); err != nil {
+		if err := rows.Scan(addr.fields()...); err != nil {
 			return nil, fmt.Errorf("scan failed: %w", err)
 		}
 		addresses = append(addresses, addr)
@@ -106,41 +262,32 @@ func SearchByAddress(street, houseNumber, city string) ([]Address, error) {
 	return addresses, nil
 }
 
-// FulltextSearch performs a full-text search using the FTS5 virtual table
-func FulltextSearch(query string) ([]Address, error) {
-	var addresses []Address
+// escapeLike escapes the LIKE wildcards in s so it is matched literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
 
-	// Add an asterisk to each term to enable prefix matching
-	// This allows partial word matches like "Hauptstraß*" to match "Hauptstraße"
-	words := strings.Fields(query)
-	for i, word := range words {
-		words[i] = word + "*"
-	}
-	modifiedQuery := strings.Join(words, " ")
+// escapeGlob escapes the GLOB wildcards in s so it is matched literally
+func escapeGlob(s string) string {
+	return strings.NewReplacer("[", "[[]", "*", "[*]", "?", "[?]").Replace(s)
+}
 
-	sqlQuery := `
-		SELECT a.id, a.street, a.house_number, a.city, a.longitude, a.latitude
-		FROM address_fts
-		JOIN addresses a ON address_fts.rowid = a.id
-		WHERE address_fts MATCH ?
-		ORDER BY rank
-		LIMIT 100
-	`
+// quoteTerm quotes s as an FTS5 string so it is matched literally
+func quoteTerm(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
 
-	rows, err := db.Query(sqlQuery, modifiedQuery)
+// FulltextSearch performs a full-text search using the FTS5 virtual table
+func FulltextSearch(query string) ([]Address, error) {
+	matches, _, err := AdvancedFulltextSearch(query, SearchOptions{Limit: 100})
 	if err != nil {
-		return nil, fmt.Errorf("fulltext search failed: %w", err)
+		return nil, err
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var addr Address
-		if err := rows.Scan(&addr.ID, &addr.Street, &addr.HouseNumber, &addr.City, &addr.Longitude, &addr.Latitude); err != nil {
-			return nil, fmt.Errorf("scan failed: %w", err)
-		}
-		addresses = append(addresses, addr)
+	var addresses []Address
+	for _, m := range matches {
+		addresses = append(addresses, m.Address)
 	}
-
 	return addresses, nil
 }
 
@@ -148,8 +295,8 @@ func FulltextSearch(query string) ([]Address, error) {
 func GetAddressById(id int64) (*Address, error) {
 	var addr Address
 
-	err := db.QueryRow("SELECT id, street, house_number, city, longitude, latitude FROM addresses WHERE id = ?", id).
-		Scan(&addr.ID, &addr.Street, &addr.HouseNumber, &addr.City, &addr.Longitude, &addr.Latitude)
+	err := db.QueryRow("SELECT "+addressColumns("a")+" FROM addresses a WHERE a.id = ?", id).
+		Scan(addr.fields()...)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -162,43 +309,88 @@ func GetAddressById(id int64) (*Address, error) {
 }
 
 // FindAddressesInRadius finds addresses within a specified radius (in km) of a point
-func FindAddressesInRadius(latitude, longitude float64, radiusKm float64) ([]Address, error) {
+// and returns them with their distances in km. Results are ordered by distance and
+// returned in pages of at most limit rows, starting after the given cursor. The
+// returned cursor is nil on the last page.
+func FindAddressesInRadius(latitude, longitude float64, radiusKm float64, after *Cursor, limit int) ([]Address, []float64, *Cursor, error) {
+	return findInRadius(latitude, longitude, radiusKm, 0, after, limit)
+}
+
+// FindNearbyAddresses finds the addresses within a radius (in km) of the address
+// with the given ID, excluding the address itself. Results are ordered and
+// paged like FindAddressesInRadius and come with their distances in km.
+// It returns a nil origin if no address has the ID.
+func FindNearbyAddresses(id int64, radiusKm float64, after *Cursor, limit int) (origin *Address, addresses []Address, distances []float64, next *Cursor, err error) {
+	origin, err = GetAddressById(id)
+	if err != nil || origin == nil {
+		return nil, nil, nil, nil, err
+	}
+	addresses, distances, next, err = findInRadius(origin.Latitude, origin.Longitude, radiusKm, id, after, limit)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	return origin, addresses, distances, next, nil
+}
+
+// findInRadius runs the radius search of FindAddressesInRadius, leaving out
+// the address excludeID unless it is 0, and also returns the distances in km.
+func findInRadius(latitude, longitude float64, radiusKm float64, excludeID int64, after *Cursor, limit int) ([]Address, []float64, *Cursor, error) {
+	if limit <= 0 || limit > 1000 {
+		limit = 100 // Default limit with a maximum
+	}
+
 	var addresses []Address
+	keyset, keysetArgs := keysetFilter(after, "distance", "id")
 
-	// Haversine formula in SQL to calculate distance
+	// The exact distance is only calculated for the addresses inside the
+	// bounding box of the circle, which the spatial index finds quickly
+	box, boxArgs := boxCondition("a", Around(Point{Latitude: latitude, Longitude: longitude}, radiusKm)...)
 	query := `
-		SELECT id, street, house_number, city, longitude, latitude,
-		       (6371 * acos(cos(radians(?)) * cos(radians(latitude)) * 
-		       cos(radians(longitude) - radians(?)) + 
-		       sin(radians(?)) * sin(radians(latitude)))) AS distance 
-		FROM addresses 
-		WHERE (6371 * acos(cos(radians(?)) * cos(radians(latitude)) * 
-		      cos(radians(longitude) - radians(?)) + 
-		      sin(radians(?)) * sin(radians(latitude)))) < ? 
-		ORDER BY distance 
-		LIMIT 100
+		SELECT ` + addressColumns("a") + `, distance
+		FROM (
+			SELECT a.*, distance_km(?, ?, a.latitude, a.longitude) AS distance
+			FROM addresses a
+			WHERE ` + box + `
+		) a
+		WHERE distance < ? AND id != ? AND ` + keyset + `
+		ORDER BY distance, id
+		LIMIT ?
 	`
-	rows, err := db.Query(query, latitude, longitude, latitude, latitude, longitude, latitude, radiusKm)
+	args := []interface{}{latitude, longitude}
+	args = append(args, boxArgs...)
+	args = append(args, radiusKm, excludeID)
+	args = append(args, keysetArgs...)
+	args = append(args, limit+1)
+
+	rows, err := db.Query(query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("radius search failed: %w", err)
+		return nil, nil, nil, fmt.Errorf("radius search failed: %w", err)
 	}
 	defer rows.Close()
 
+	var distances []float64
+	var next *Cursor
 	for rows.Next() {
 		var addr Address
 		var distance float64
-		if err := rows.Scan(&addr.ID, &addr.Street, &addr.HouseNumber, &addr.City,
-			&addr.Longitude, &addr.Latitude, &distance); err != nil {
-			return nil, fmt.Errorf("scan failed: %w", err)
+		if err := rows.Scan(append(addr.fields(), &distance)...); err != nil {
+			return nil, nil, nil, fmt.Errorf("scan failed: %w", err)
+		}
+		if len(addresses) == limit {
+			last := addresses[len(addresses)-1]
+			next = &Cursor{Score: distances[len(distances)-1], ID: last.ID}
+			break
 		}
 		addresses = append(addresses, addr)
+		distances = append(distances, distance)
 	}
 
-	return addresses, nil
+	return addresses, distances, next, nil
 }
 
-// GetAddressesByCity gets addresses for a specific city with pagination
-func GetAddressesByCity(city string, page, pageSize int) ([]Address, error) {
+// GetAddressesByCity gets addresses for a specific city with pagination, ordered
+// by ID so the pages are stable. It also returns the number of addresses of the city.
+func GetAddressesByCity(city string, page, pageSize int) ([]Address, int64, error) {
 	if page < 1 {
 		page = 1
 	}
@@ -208,24 +400,29 @@ func GetAddressesByCity(city string, page, pageSize int) ([]Address, error) {
 
 	offset := (page - 1) * pageSize
 
+	var total int64
+	if err := db.QueryRow("SELECT COUNT(*) FROM addresses WHERE city = ?", city).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("count addresses by city failed: %w", err)
+	}
+
 	var addresses []Address
-	query := "SELECT id, street, house_number, city, longitude, latitude FROM addresses WHERE city = ? LIMIT ? OFFSET ?"
+	query := "SELECT " + addressColumns("a") + " FROM addresses a WHERE a.city = ? ORDER BY a.id LIMIT ? OFFSET ?"
 
 	rows, err := db.Query(query, city, pageSize, offset)
 	if err != nil {
-		return nil, fmt.Errorf("get addresses by city failed: %w", err)
+		return nil, 0, fmt.Errorf("get addresses by city failed: %w", err)
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		var addr Address
-		if err := rows.Scan(&addr.ID, &addr.Street, &addr.HouseNumber, &addr.City, &addr.Longitude, &addr.Latitude); err != nil {
-			return nil, fmt.Errorf("scan failed: %w", err)
+		if err := rows.Scan(addr.fields()...); err != nil {
+			return nil, 0, fmt.Errorf("scan failed: %w", err)
 		}
 		addresses = append(addresses, addr)
 	}
 
-	return addresses, nil
+	return addresses, total, rows.Err()
 }
 
 // GetAddressCount returns the total count of addresses in the database
@@ -238,26 +435,64 @@ func GetAddressCount() (int64, error) {
 	return count, nil
 }
 
-// GetCitySummary returns the count of addresses in each city
-func GetCitySummary() (map[string]int64, error) {
-	result := make(map[string]int64)
+// CitySummary represents a city with its number of addresses
+type CitySummary struct {
+	City         string `json:"city"`
+	AddressCount int64  `json:"address_count"`
+}
+
+// Orders of GetCitySummary
+const (
+	CitySortName  = "name"  // Alphabetically
+	CitySortCount = "count" // Most addresses first
+)
+
+// GetCitySummary returns the count of addresses in each city whose name starts
+// with prefix, ordered by sortBy and paginated. An empty prefix matches all
+// cities. It also returns the number of matching cities.
+func GetCitySummary(prefix, sortBy string, page, pageSize int) ([]CitySummary, int64, error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 1000 {
+		pageSize = 100 // Default page size with a maximum
+	}
+	order := "city"
+	if sortBy == CitySortCount {
+		order = "count DESC, city"
+	}
+
+	offset := (page - 1) * pageSize
+	pattern := escapeGlob(prefix) + "*"
+
+	var total int64
+	if err := db.QueryRow("SELECT COUNT(DISTINCT city) FROM addresses WHERE city GLOB ?", pattern).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("city count query failed: %w", err)
+	}
 
-	rows, err := db.Query("SELECT city, COUNT(*) as count FROM addresses GROUP BY city ORDER BY count DESC LIMIT 1000")
+	rows, err := db.Query(`
+		SELECT city, COUNT(*) as count
+		FROM addresses
+		WHERE city GLOB ?
+		GROUP BY city
+		ORDER BY `+order+`
+		LIMIT ? OFFSET ?
+	`, pattern, pageSize, offset)
 	if err != nil {
-		return nil, fmt.Errorf("city summary query failed: %w", err)
+		return nil, 0, fmt.Errorf("city summary query failed: %w", err)
 	}
 	defer rows.Close()
 
+	var cities []CitySummary
 	for rows.Next() {
-		var city string
-		var count int64
-		if err := rows.Scan(&city, &count); err != nil {
-			return nil, fmt.Errorf("scan failed: %w", err)
+		var city CitySummary
+		if err := rows.Scan(&city.City, &city.AddressCount); err != nil {
+			return nil, 0, fmt.Errorf("scan failed: %w", err)
 		}
-		result[city] = count
+		cities = append(cities, city)
 	}
 
-	return result, nil
+	return cities, total, rows.Err()
 }
 
 // CalculateDistance calculates the distance between two coordinates using the Haversine formula
@@ -283,94 +518,307 @@ func CalculateDistance(lat1, lon1, lat2, lon2 float64) float64 {
 	return R * c // Distance in kilometers
 }
 
+// CalculateBearing calculates the initial compass bearing in degrees from the
+// first to the second coordinate, 0 is north and 90 east
+func CalculateBearing(lat1, lon1, lat2, lon2 float64) float64 {
+	lat1Rad := lat1 * math.Pi / 180.0
+	lat2Rad := lat2 * math.Pi / 180.0
+	dLon := (lon2 - lon1) * math.Pi / 180.0
+
+	y := math.Sin(dLon) * math.Cos(lat2Rad)
+	x := math.Cos(lat1Rad)*math.Sin(lat2Rad) - math.Sin(lat1Rad)*math.Cos(lat2Rad)*math.Cos(dLon)
+	bearing := math.Atan2(y, x) * 180.0 / math.Pi
+
+	return math.Mod(bearing+360.0, 360.0)
+}
+
 // HighlightedMatch represents a search result with highlighted matches
 type HighlightedMatch struct {
 	Address          Address `json:"address"`
 	StreetMatch      string  `json:"street_match,omitempty"`
 	HouseNumberMatch string  `json:"house_number_match,omitempty"`
 	CityMatch        string  `json:"city_match,omitempty"`
+	PostcodeMatch    string  `json:"postcode_match,omitempty"`
 }
 
-// AdvancedFulltextSearch performs a column-specific fulltext search with highlighting
-// Optional parameters:
-// - street: search only in street column
-// - houseNumber: search only in house_number column
-// - city: search only in city column
-// If parameter is empty, all columns will be searched
-func AdvancedFulltextSearch(query string, limit int, highlight bool) ([]interface{}, error) {
-	if limit <= 0 || limit > 1000 {
-		limit = 100 // Default limit with a maximum
+// SearchOptions controls paging and highlighting of a fulltext search
+type SearchOptions struct {
+	Limit          int     // Page size
+	After          *Cursor // Continue after this row, nil for the first page
+	Highlight      bool
+	HighlightStart string // Marker inserted before each matched token, defaults to "<b>"
+	HighlightEnd   string // Marker inserted after each matched token, defaults to "</b>"
+
+	// Focus biases the ranking towards addresses close to this point, nil disables
+	// the bias. FocusWeight scales the logarithm of the distance in km that is
+	// added to the rank.
+	Focus       *Point
+	FocusWeight float64
+
+	// Filters restricting the results. They are applied in the query, before
+	// the results are ranked and paged.
+	City     string  // Only addresses in this city, compared in normalized form
+	Postcode string  // Only addresses whose postcode starts with this, requires a database with postcodes
+	BBox     *BBox   // Only addresses inside this box
+	Near     *Point  // Only addresses within RadiusKm of this point
+	RadiusKm float64 // Radius around Near
+}
+
+// hasFilters reports whether any of the result filters is set
+func (opts SearchOptions) hasFilters() bool {
+	return opts.City != "" || opts.Postcode != "" || opts.BBox != nil || opts.Near != nil
+}
+
+// filters returns the SQL conditions for the result filters, each starting
+// with AND, for the addresses table aliased as a
+func (opts SearchOptions) filters() (string, []interface{}) {
+	var conditions string
+	var args []interface{}
+
+	if opts.City != "" {
+		conditions += " AND normalize_address(a.city) = ?"
+		args = append(args, normalize.Text(opts.City))
+	}
+	if opts.Postcode != "" {
+		conditions += " AND a.postcode GLOB ?"
+		args = append(args, escapeGlob(opts.Postcode)+"*")
+	}
+	if opts.BBox != nil {
+		conditions += " AND a.longitude BETWEEN ? AND ? AND a.latitude BETWEEN ? AND ?"
+		args = append(args, opts.BBox.MinLon, opts.BBox.MaxLon, opts.BBox.MinLat, opts.BBox.MaxLat)
+	}
+	if opts.Near != nil {
+		// The bounding box of the circle cheaply excludes most addresses before
+		// the exact distance is calculated
+		box, boxArgs := exactBoxCondition("a", Around(*opts.Near, opts.RadiusKm))
+		conditions += " AND " + box + " AND distance_km(?, ?, a.latitude, a.longitude) <= ?"
+		args = append(append(args, boxArgs...), opts.Near.Latitude, opts.Near.Longitude, opts.RadiusKm)
 	}
 
-	// Add an asterisk to each term to enable prefix matching
-	// This allows partial word matches like "Hauptstraß*" to match "Hauptstraße"
-	words := strings.Fields(query)
-	for i, word := range words {
-		words[i] = word + "*"
-	}
-	modifiedQuery := strings.Join(words, " ")
-
-	var results []interface{}
-	var sqlQuery string
-	if highlight {
-		// Query with highlighting
-		sqlQuery = `
-			SELECT a.id, a.street, a.house_number, a.city, a.longitude, a.latitude,
-				highlight(address_fts, 0, '<b>', '</b>') as street_match,
-				highlight(address_fts, 1, '<b>', '</b>') as house_number_match,
-				highlight(address_fts, 2, '<b>', '</b>') as city_match
-			FROM address_fts
-			JOIN addresses a ON address_fts.rowid = a.id
-			WHERE address_fts MATCH ?
-			ORDER BY rank
-			LIMIT ?
-		`
+	return conditions, args
+}
 
-		rows, err := db.Query(sqlQuery, modifiedQuery, limit)
-		if err != nil {
-			return nil, fmt.Errorf("advanced fulltext search failed: %w", err)
+// AdvancedFulltextSearch performs a fulltext search over all columns and optionally
+// returns the street, house number and city with the matched words highlighted.
+// The match fields are left empty when highlighting is disabled.
+// The query is normalized with normalize.Text and matched against the normalized index.
+// Results are ordered by rank and returned in pages of at most opts.Limit rows;
+// the returned cursor points to the next page and is nil on the last page.
+func AdvancedFulltextSearch(query string, opts SearchOptions) ([]HighlightedMatch, *Cursor, error) {
+	return ColumnSearch(ColumnQuery{Text: query}, opts)
+}
+
+// ColumnQuery is a fulltext query whose parts are matched against single columns.
+// Text is matched against all columns, empty parts are ignored.
+type ColumnQuery struct {
+	Street            string
+	HouseNumbers      []string // Exact house numbers, any of them matches
+	HouseNumberPrefix bool     // Match the house numbers by prefix instead, for autocompletion
+	Postcode          string   // Matched exactly, ignored if the database has no postcodes
+	City              string
+	Text              string
+
+	Phrases  []Phrase // Must all match
+	Excluded []Phrase // Must not match, ignored unless any other part is set
+}
+
+// Phrase is a sequence of words matched exactly and in this order
+type Phrase struct {
+	Column string // street, house_number, postcode or city, empty for all columns
+	Text   string
+}
+
+// expression returns the phrase as FTS5 expression and its normalized words
+func (p Phrase) expression() (string, []string) {
+	words := strings.Fields(normalize.Text(p.Text))
+	expression := quoteTerm(strings.Join(words, " "))
+	if p.Column != "" {
+		expression = p.Column + " : " + expression
+	}
+	return expression, words
+}
+
+// expression compiles the query into an FTS5 MATCH expression for the normalized
+// index and returns it together with the normalized terms used for highlighting.
+// Every word is matched by prefix, house numbers exactly unless HouseNumberPrefix is set.
+func (q ColumnQuery) expression() (string, []string) {
+	var groups, terms []string
+
+	// Add an asterisk to each term to enable prefix matching
+	// This allows partial word matches like "Hauptstras*" to match "Hauptstrasse"
+	prefixed := func(text string) string {
+		var words []string
+		for _, term := range strings.Fields(normalize.Text(text)) {
+			words = append(words, quoteTerm(term)+"*")
+			terms = append(terms, term)
 		}
-		defer rows.Close()
-
-		for rows.Next() {
-			var result HighlightedMatch
-			var addr Address
-			if err := rows.Scan(
-				&addr.ID, &addr.Street, &addr.HouseNumber, &addr.City,
-				&addr.Longitude, &addr.Latitude,
-				&result.StreetMatch, &result.HouseNumberMatch, &result.CityMatch,
-			); err != nil {
-				return nil, fmt.Errorf("scan failed: %w", err)
+		return strings.Join(words, " ")
+	}
+
+	if words := prefixed(q.Street); words != "" {
+		groups = append(groups, "street : ("+words+")")
+	}
+	if len(q.HouseNumbers) > 0 {
+		var numbers []string
+		for _, number := range q.HouseNumbers {
+			number = normalize.Word(number)
+			if q.HouseNumberPrefix {
+				numbers = append(numbers, quoteTerm(number)+"*")
+			} else {
+				numbers = append(numbers, quoteTerm(number))
 			}
-			result.Address = addr
-			results = append(results, result)
+			terms = append(terms, number)
 		}
-	} else {
-		// Query without highlighting
-		sqlQuery = `
-			SELECT a.id, a.street, a.house_number, a.city, a.longitude, a.latitude
-			FROM address_fts
-			JOIN addresses a ON address_fts.rowid = a.id
-			WHERE address_fts MATCH ?
-			ORDER BY rank
-			LIMIT ?
-		`
+		groups = append(groups, "house_number : ("+strings.Join(numbers, " OR ")+")")
+	}
+	if q.Postcode != "" && hasPostcode {
+		groups = append(groups, "postcode : "+quoteTerm(q.Postcode))
+		terms = append(terms, q.Postcode)
+	}
+	if words := prefixed(q.City); words != "" {
+		groups = append(groups, "city : ("+words+")")
+	}
+	if words := prefixed(q.Text); words != "" {
+		groups = append(groups, words)
+	}
+	for _, phrase := range q.Phrases {
+		expression, words := phrase.expression()
+		groups = append(groups, expression)
+		terms = append(terms, words...)
+	}
+	if len(groups) == 0 {
+		return "", nil
+	}
 
-		rows, err := db.Query(sqlQuery, modifiedQuery, limit)
-		if err != nil {
-			return nil, fmt.Errorf("advanced fulltext search failed: %w", err)
+	expression := strings.Join(groups, " AND ")
+	if len(q.Excluded) > 0 {
+		// NOT is a binary operator in FTS5, the excluded phrases are
+		// subtracted from the matches of all other parts
+		expression = "(" + expression + ")"
+		for _, phrase := range q.Excluded {
+			excluded, _ := phrase.expression()
+			expression += " NOT " + excluded
 		}
-		defer rows.Close()
+	}
+	return expression, terms
+}
 
-		for rows.Next() {
-			var addr Address
-			if err := rows.Scan(&addr.ID, &addr.Street, &addr.HouseNumber, &addr.City,
-				&addr.Longitude, &addr.Latitude); err != nil {
-				return nil, fmt.Errorf("scan failed: %w", err)
+// ColumnSearch performs a fulltext search with column specific filters, see
+// AdvancedFulltextSearch for highlighting and paging.
+func ColumnSearch(query ColumnQuery, opts SearchOptions) ([]HighlightedMatch, *Cursor, error) {
+	return ColumnSearchAny([]ColumnQuery{query}, opts)
+}
+
+// ColumnSearchAny performs a fulltext search for addresses matching any of
+// the queries, ranked and paged together like ColumnSearch.
+func ColumnSearchAny(queries []ColumnQuery, opts SearchOptions) ([]HighlightedMatch, *Cursor, error) {
+	var alternatives, terms []string
+	for _, query := range queries {
+		for _, phrase := range append(query.Phrases, query.Excluded...) {
+			if phrase.Column == "postcode" && !hasPostcode {
+				return nil, nil, ErrNoPostcodes
 			}
-			results = append(results, addr)
 		}
+		expression, queryTerms := query.expression()
+		if expression == "" {
+			continue
+		}
+		alternatives = append(alternatives, expression)
+		terms = append(terms, queryTerms...)
+	}
+	switch len(alternatives) {
+	case 0:
+		return nil, nil, nil
+	case 1:
+		return matchFulltext(alternatives[0], terms, opts)
+	}
+	return matchFulltext("("+strings.Join(alternatives, ") OR (")+")", terms, opts)
+}
+
+// matchFulltext runs an FTS5 MATCH expression against the normalized index and
+// returns one page of results ordered by rank. Words starting with one of the
+// normalized terms are highlighted if requested.
+func matchFulltext(modifiedQuery string, terms []string, opts SearchOptions) ([]HighlightedMatch, *Cursor, error) {
+	if opts.Limit <= 0 || opts.Limit > 1000 {
+		opts.Limit = 100 // Default limit with a maximum
+	}
+	if opts.Postcode != "" && !hasPostcode {
+		return nil, nil, ErrNoPostcodes
+	}
+
+	// Rows are ordered by their BM25 rank, which is negative and lower for
+	// better matches, plus the optional distance penalty
+	var args []interface{}
+	score := "address_norm_fts.rank"
+	if opts.Focus != nil {
+		score += " + ? * ln(1 + distance_km(?, ?, a.latitude, a.longitude))"
+		args = append(args, opts.FocusWeight, opts.Focus.Latitude, opts.Focus.Longitude)
+	}
+	join := ""
+	if opts.Focus != nil || opts.hasFilters() {
+		join = "JOIN addresses a ON a.id = address_norm_fts.rowid"
+	}
+
+	filters, filterArgs := opts.filters()
+	keyset, keysetArgs := keysetFilter(opts.After, "score", "id")
+	args = append(args, modifiedQuery)
+	args = append(args, filterArgs...)
+	args = append(args, keysetArgs...)
+	args = append(args, opts.Limit+1)
+
+	// The page is selected on the FTS index first, so the addresses are only
+	// joined for the rows that are actually returned unless the ranking needs them.
+	sqlQuery := `
+		WITH page AS MATERIALIZED (
+			SELECT id, score FROM (
+				SELECT address_norm_fts.rowid AS id, ` + score + ` AS score
+				FROM address_norm_fts
+				` + join + `
+				WHERE address_norm_fts MATCH ?` + filters + `
+			)
+			WHERE ` + keyset + `
+			ORDER BY score, id
+			LIMIT ?
+		)
+		SELECT ` + addressColumns("a") + `, page.score
+		FROM page
+		JOIN addresses a ON a.id = page.id
+		ORDER BY page.score, page.id
+	`
+
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("advanced fulltext search failed: %w", err)
+	}
+	defer rows.Close()
+
+	start, end := opts.HighlightStart, opts.HighlightEnd
+	if start == "" && end == "" {
+		start, end = "<b>", "</b>"
+	}
+
+	var results []HighlightedMatch
+	var next *Cursor
+	var lastScore float64
+	for rows.Next() {
+		var result HighlightedMatch
+		var score float64
+		if err := rows.Scan(append(result.Address.fields(), &score)...); err != nil {
+			return nil, nil, fmt.Errorf("scan failed: %w", err)
+		}
+		if len(results) == opts.Limit {
+			next = &Cursor{Score: lastScore, ID: results[len(results)-1].Address.ID}
+			break
+		}
+		if opts.Highlight {
+			result.StreetMatch = highlightText(result.Address.Street, terms, start, end)
+			result.HouseNumberMatch = highlightText(result.Address.HouseNumber, terms, start, end)
+			result.CityMatch = highlightText(result.Address.City, terms, start, end)
+			result.PostcodeMatch = highlightText(result.Address.Postcode, terms, start, end)
+		}
+		results = append(results, result)
+		lastScore = score
 	}
 
-	return results, nil
+	return results, next, nil
 }
@@ -0,0 +1,158 @@
+package sql
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// StreetSummary represents a street of a city with the area its addresses cover
+type StreetSummary struct {
+	Street       string `json:"street"`
+	AddressCount int64  `json:"address_count"`
+	Center       Point  `json:"center"` // Mean position of the addresses
+	BBox         BBox   `json:"bbox"`
+}
+
+// StreetNumber represents a house number of a street
+type StreetNumber struct {
+	ID          int64   `json:"id"`
+	HouseNumber string  `json:"house_number"`
+	Longitude   float64 `json:"longitude"`
+	Latitude    float64 `json:"latitude"`
+	Postcode    string  `json:"postcode,omitempty"`
+}
+
+// CityExists reports whether any address lies in the city
+func CityExists(city string) (bool, error) {
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM addresses WHERE city = ?)", city).Scan(&exists); err != nil {
+		return false, fmt.Errorf("city lookup failed: %w", err)
+	}
+	return exists, nil
+}
+
+// GetStreetsByCity returns the streets of a city whose name starts with prefix
+// in alphabetical order with pagination. An empty prefix matches all streets.
+// It also returns the number of matching streets.
+func GetStreetsByCity(city, prefix string, page, pageSize int) ([]StreetSummary, int64, error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 1000 {
+		pageSize = 100 // Default page size with a maximum
+	}
+
+	offset := (page - 1) * pageSize
+	pattern := escapeGlob(prefix) + "*"
+
+	var total int64
+	err := db.QueryRow("SELECT COUNT(DISTINCT street) FROM addresses WHERE city = ? AND street GLOB ?", city, pattern).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("street count query failed: %w", err)
+	}
+
+	rows, err := db.Query(`
+		SELECT street, COUNT(*), AVG(latitude), AVG(longitude),
+		       MIN(longitude), MIN(latitude), MAX(longitude), MAX(latitude)
+		FROM addresses
+		WHERE city = ? AND street GLOB ?
+		GROUP BY street
+		ORDER BY street
+		LIMIT ? OFFSET ?
+	`, city, pattern, pageSize, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("street summary query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var streets []StreetSummary
+	for rows.Next() {
+		var s StreetSummary
+		if err := rows.Scan(&s.Street, &s.AddressCount, &s.Center.Latitude, &s.Center.Longitude,
+			&s.BBox.MinLon, &s.BBox.MinLat, &s.BBox.MaxLon, &s.BBox.MaxLat); err != nil {
+			return nil, 0, fmt.Errorf("scan failed: %w", err)
+		}
+		streets = append(streets, s)
+	}
+
+	return streets, total, rows.Err()
+}
+
+// GetStreetNumbers returns the house numbers of a street of a city in natural
+// order, so "2" comes before "2a" and "10". It returns an empty list if the
+// street doesn't exist in the city.
+func GetStreetNumbers(city, street string) ([]StreetNumber, error) {
+	// The rows are looked up by street through idx_street_house or the unique
+	// index on street, house number and city
+	rows, err := db.Query(`
+		SELECT `+addressColumns("a")+`
+		FROM addresses a
+		WHERE a.street = ? AND a.city = ?
+	`, street, city)
+	if err != nil {
+		return nil, fmt.Errorf("street numbers query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var numbers []StreetNumber
+	for rows.Next() {
+		var addr Address
+		if err := rows.Scan(addr.fields()...); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		numbers = append(numbers, StreetNumber{
+			ID:          addr.ID,
+			HouseNumber: addr.HouseNumber,
+			Longitude:   addr.Longitude,
+			Latitude:    addr.Latitude,
+			Postcode:    addr.Postcode,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("street numbers query failed: %w", err)
+	}
+
+	sort.Slice(numbers, func(i, j int) bool {
+		return HouseNumberLess(numbers[i].HouseNumber, numbers[j].HouseNumber)
+	})
+	return numbers, nil
+}
+
+// HouseNumberLess compares house numbers by their runs of digits as numbers and
+// the text in between case-insensitively, so "2" < "2a" < "2b" < "10" < "10-12"
+func HouseNumberLess(a, b string) bool {
+	ra, rb := []rune(strings.ToLower(a)), []rune(strings.ToLower(b))
+	i, j := 0, 0
+	for i < len(ra) && j < len(rb) {
+		if unicode.IsDigit(ra[i]) && unicode.IsDigit(rb[j]) {
+			si, sj := i, j
+			for i < len(ra) && unicode.IsDigit(ra[i]) {
+				i++
+			}
+			for j < len(rb) && unicode.IsDigit(rb[j]) {
+				j++
+			}
+			// Compare the numbers without leading zeros by length, then digit by digit
+			na := strings.TrimLeft(string(ra[si:i]), "0")
+			nb := strings.TrimLeft(string(rb[sj:j]), "0")
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			continue
+		}
+		if ra[i] != rb[j] {
+			return ra[i] < rb[j]
+		}
+		i++
+		j++
+	}
+	if len(ra)-i != len(rb)-j {
+		return len(ra)-i < len(rb)-j
+	}
+	return a < b
+}
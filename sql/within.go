@@ -0,0 +1,247 @@
+package sql
+
+import (
+	"fmt"
+	"math"
+)
+
+// Polygon is an area bounded by an outer ring and optionally containing
+// holes. A ring is a list of points whose last point connects to the first.
+type Polygon struct {
+	Outer []Point
+	Holes [][]Point
+}
+
+// Area is the union of polygons, like a GeoJSON MultiPolygon
+type Area []Polygon
+
+// bbox returns the smallest box containing the polygon
+func (p Polygon) bbox() BBox {
+	box := BBox{MinLon: math.Inf(1), MinLat: math.Inf(1), MaxLon: math.Inf(-1), MaxLat: math.Inf(-1)}
+	for _, point := range p.Outer {
+		box.MinLon = math.Min(box.MinLon, point.Longitude)
+		box.MinLat = math.Min(box.MinLat, point.Latitude)
+		box.MaxLon = math.Max(box.MaxLon, point.Longitude)
+		box.MaxLat = math.Max(box.MaxLat, point.Latitude)
+	}
+	return box
+}
+
+// contains reports whether the point lies inside the outer ring and outside all holes
+func (p Polygon) contains(point Point) bool {
+	if !ringContains(p.Outer, point) {
+		return false
+	}
+	for _, hole := range p.Holes {
+		if ringContains(hole, point) {
+			return false
+		}
+	}
+	return true
+}
+
+// contains reports whether the point lies inside any of the polygons
+func (a Area) contains(point Point) bool {
+	for _, p := range a {
+		if p.contains(point) {
+			return true
+		}
+	}
+	return false
+}
+
+// largeAreaFraction is the share of the addresses above which an area is
+// searched by reading the whole table. SQLite sorts the IDs found by the
+// R*Tree before reading the first address, which takes longer than a full
+// scan once the area contains a sixteenth of the addresses.
+const largeAreaFraction = 16
+
+// boxes returns the bounding boxes of the polygons
+func (a Area) boxes() []BBox {
+	boxes := make([]BBox, len(a))
+	for i, p := range a {
+		boxes[i] = p.bbox()
+	}
+	return boxes
+}
+
+// areaCondition returns the SQL condition selecting the addresses inside the
+// boxes from the addresses table aliased as alias. Unlike boxCondition, it
+// leaves out the R*Tree for boxes containing many addresses.
+func areaCondition(alias string, boxes []BBox) (string, []interface{}, error) {
+	// Reading the whole table is no option for many boxes, comparing every
+	// address with all of them takes longer than sorting the candidates
+	if !hasSpatialIndex || len(boxes) > maxQueryBoxes {
+		condition, args := boxCondition(alias, boxes...)
+		return condition, args, nil
+	}
+
+	// Count the candidates of the R*Tree up to the share of a large area
+	var total, candidates int64
+	if err := db.QueryRow("SELECT COALESCE(MAX(id), 0) FROM addresses").Scan(&total); err != nil {
+		return "", nil, fmt.Errorf("address count failed: %w", err)
+	}
+	limit := total / largeAreaFraction
+	query, args := rtreeCandidates(boxes)
+	if err := db.QueryRow("SELECT COUNT(*) FROM ("+query+" LIMIT ?)", append(args, limit+1)...).Scan(&candidates); err != nil {
+		return "", nil, fmt.Errorf("candidate count failed: %w", err)
+	}
+	if candidates > limit {
+		condition, args := exactBoxCondition(alias, boxes)
+		return condition, args, nil
+	}
+	condition, args := boxCondition(alias, boxes...)
+	return condition, args, nil
+}
+
+// ringContains reports whether the point lies inside the ring by counting the
+// edges a ray from the point towards east crosses. Longitude and latitude are
+// treated as plane coordinates, which is precise enough for areas of a few
+// hundred kilometers.
+func ringContains(ring []Point, point Point) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a, b := ring[i], ring[j]
+		if (a.Latitude > point.Latitude) != (b.Latitude > point.Latitude) {
+			crossing := a.Longitude + (point.Latitude-a.Latitude)/(b.Latitude-a.Latitude)*(b.Longitude-a.Longitude)
+			if point.Longitude < crossing {
+				inside = !inside
+			}
+		}
+	}
+	return inside
+}
+
+// FindAddressesWithin returns the addresses inside the area ordered by ID in
+// pages of at most limit rows, starting after the given cursor. The returned
+// cursor is nil on the last page. The bounding boxes of the polygons select
+// the candidates, which are then checked against the polygons.
+func FindAddressesWithin(area Area, after *Cursor, limit int) ([]Address, *Cursor, error) {
+	if limit <= 0 || limit > 10000 {
+		limit = 1000 // Default limit with a maximum
+	}
+	condition, args, err := areaCondition("a", area.boxes())
+	if err != nil {
+		return nil, nil, err
+	}
+	return findInBoxes(condition, args, area.contains, after, limit)
+}
+
+// MaxBBoxAddresses is the number of addresses of a box that can be fetched
+// over all pages. Maps cannot show more addresses readably, so the client
+// should zoom in instead.
+const MaxBBoxAddresses = 10000
+
+// FindAddressesInBBox returns the addresses inside the box ordered by ID in
+// pages of at most limit rows, starting after the given cursor. The returned
+// cursor is nil on the last page. Only the first MaxBBoxAddresses addresses
+// are returned; truncated reports whether the box contains more addresses
+// than the pages up to this one.
+func FindAddressesInBBox(box BBox, after *Cursor, limit int) ([]Address, *Cursor, bool, error) {
+	if limit <= 0 || limit > 5000 {
+		limit = 500 // Default limit with a maximum
+	}
+	condition, args, err := areaCondition("a", []BBox{box})
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	// The cap is counted from the database rather than kept in the cursor,
+	// which the client could change
+	remaining := MaxBBoxAddresses
+	if after != nil {
+		var skipped int
+		err := db.QueryRow(`
+			SELECT COUNT(*) FROM (
+				SELECT 1 FROM addresses a WHERE `+condition+` AND a.id <= ? LIMIT ?
+			)
+		`, append(args, after.ID, MaxBBoxAddresses)...).Scan(&skipped)
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("bbox count failed: %w", err)
+		}
+		remaining -= skipped
+	}
+	if remaining <= 0 {
+		return nil, nil, true, nil
+	}
+
+	addresses, next, err := findInBoxes(condition, args, nil, after, min(limit, remaining))
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if next != nil && len(addresses) == remaining {
+		return addresses, nil, true, nil
+	}
+	return addresses, next, next != nil, nil
+}
+
+// findInBoxes returns a page of the addresses matching the condition of
+// areaCondition for which contains, if not nil, returns true
+func findInBoxes(condition string, args []interface{}, contains func(Point) bool, after *Cursor, limit int) ([]Address, *Cursor, error) {
+	var afterID int64
+	if after != nil {
+		afterID = after.ID
+	}
+
+	// Without LIMIT, the rows are read until the page is full
+	rows, err := db.Query(`
+		SELECT `+addressColumns("a")+`
+		FROM addresses a
+		WHERE `+condition+` AND a.id > ?
+		ORDER BY a.id
+	`, append(args, afterID)...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("area search failed: %w", err)
+	}
+	defer rows.Close()
+
+	var addresses []Address
+	var next *Cursor
+	for rows.Next() {
+		var addr Address
+		if err := rows.Scan(addr.fields()...); err != nil {
+			return nil, nil, fmt.Errorf("scan failed: %w", err)
+		}
+		if contains != nil && !contains(Point{Latitude: addr.Latitude, Longitude: addr.Longitude}) {
+			continue
+		}
+		if len(addresses) == limit {
+			next = &Cursor{ID: addresses[len(addresses)-1].ID}
+			break
+		}
+		addresses = append(addresses, addr)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("area search failed: %w", err)
+	}
+
+	return addresses, next, nil
+}
+
+// CountAddressesWithin returns the number of addresses inside the area
+func CountAddressesWithin(area Area) (int64, error) {
+	condition, args, err := areaCondition("a", area.boxes())
+	if err != nil {
+		return 0, err
+	}
+	rows, err := db.Query("SELECT a.latitude, a.longitude FROM addresses a WHERE "+condition, args...)
+	if err != nil {
+		return 0, fmt.Errorf("area count failed: %w", err)
+	}
+	defer rows.Close()
+
+	var count int64
+	for rows.Next() {
+		var point Point
+		if err := rows.Scan(&point.Latitude, &point.Longitude); err != nil {
+			return 0, fmt.Errorf("scan failed: %w", err)
+		}
+		if area.contains(point) {
+			count++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("area count failed: %w", err)
+	}
+	return count, nil
+}
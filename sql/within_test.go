@@ -0,0 +1,80 @@
+package sql
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestFindAddressesWithin(t *testing.T) {
+	createTestDB(t, 2000)
+	spatialIndex := hasSpatialIndex
+	defer func() { hasSpatialIndex = spatialIndex }()
+
+	rows, err := db.Query("SELECT " + addressColumns("a") + " FROM addresses a ORDER BY a.id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var all []Address
+	for rows.Next() {
+		var addr Address
+		if err := rows.Scan(addr.fields()...); err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, addr)
+	}
+	rows.Close()
+
+	// Small triangles around random addresses, more than SQLite allows terms
+	// in a compound SELECT
+	r := rand.New(rand.NewSource(5))
+	for _, polygons := range []int{1, 50, 600} {
+		var area Area
+		for i := 0; i < polygons; i++ {
+			p := all[r.Intn(len(all))]
+			size := 0.001 + r.Float64()*0.02
+			area = append(area, Polygon{Outer: []Point{
+				{Latitude: p.Latitude - size, Longitude: p.Longitude - size},
+				{Latitude: p.Latitude - size, Longitude: p.Longitude + size},
+				{Latitude: p.Latitude + size, Longitude: p.Longitude},
+			}})
+		}
+		var want []int64
+		for _, addr := range all {
+			if area.contains(Point{Latitude: addr.Latitude, Longitude: addr.Longitude}) {
+				want = append(want, addr.ID)
+			}
+		}
+
+		for _, index := range []bool{true, false} {
+			hasSpatialIndex = index && spatialIndex
+
+			var got []int64
+			var after *Cursor
+			for {
+				addresses, next, err := FindAddressesWithin(area, after, 100)
+				if err != nil {
+					t.Fatalf("%d polygons, index %v: %v", polygons, index, err)
+				}
+				for _, addr := range addresses {
+					got = append(got, addr.ID)
+				}
+				if next == nil {
+					break
+				}
+				after = next
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%d polygons, index %v: found %d addresses, want %d", polygons, index, len(got), len(want))
+			}
+
+			count, err := CountAddressesWithin(area)
+			if err != nil {
+				t.Fatalf("%d polygons, index %v: %v", polygons, index, err)
+			}
+			if count != int64(len(want)) {
+				t.Errorf("%d polygons, index %v: counted %d addresses, want %d", polygons, index, count, len(want))
+			}
+		}
+	}
+}